@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const sessionsPath string = "/sessions/"
+
+// SessionInfo describes a session for the admin API.
+type SessionInfo struct {
+	Session       string            `json:"session"`
+	Url           string            `json:"url"`
+	Template      string            `json:"template"`
+	ContentType   string            `json:"content_type"`
+	Status        int               `json:"status,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Delay         *Delay            `json:"delay,omitempty"`
+	Fault         *FaultPolicy      `json:"fault,omitempty"`
+	Scenario      string            `json:"scenario,omitempty"`
+	RequiredState string            `json:"required_state,omitempty"`
+	NewState      string            `json:"new_state,omitempty"`
+	Format        string            `json:"format,omitempty"`
+	OutputCheck   bool              `json:"output_check"`
+	Schema        bool              `json:"schema,omitempty"`
+	GraphQL       bool              `json:"graphql,omitempty"`
+	Deterministic bool              `json:"deterministic,omitempty"`
+	Stream        *EventStream      `json:"stream,omitempty"`
+	WebSocket     *WebSocket        `json:"websocket,omitempty"`
+	TtlSeconds    int64             `json:"ttl_seconds"` // -1 if the session never expires
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+	Hashes        []string          `json:"hashes"`
+}
+
+func newSessionInfo(session *Session) *SessionInfo {
+	info := &SessionInfo{
+		Session:       session.Uuid,
+		Url:           fmt.Sprintf(sessionUrl, session.Uuid),
+		Template:      session.Template,
+		ContentType:   session.ContentType,
+		Status:        session.Status,
+		Headers:       session.Headers,
+		Delay:         session.Delay,
+		Fault:         session.Fault,
+		Scenario:      session.Scenario,
+		RequiredState: session.RequiredState,
+		NewState:      session.NewState,
+		Format:        session.Format,
+		OutputCheck:   session.OutputCheck,
+		Schema:        session.Schema,
+		GraphQL:       session.GraphQL,
+		Deterministic: session.Deterministic,
+		Stream:        session.Stream,
+		WebSocket:     session.WebSocket,
+		TtlSeconds:    -1,
+		Hashes:        []string{},
+	}
+	if !session.ExpiresAt.IsZero() {
+		expires := session.ExpiresAt
+		info.ExpiresAt = &expires
+		info.TtlSeconds = int64(ttlUntil(expires) / time.Second)
+	}
+	for _, result := range LocalStore.Results(session.Uuid) {
+		info.Hashes = append(info.Hashes, result.Hash)
+	}
+	sort.Strings(info.Hashes)
+	return info
+}
+
+type sessionsByUuid []*Session
+
+func (s sessionsByUuid) Len() int           { return len(s) }
+func (s sessionsByUuid) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sessionsByUuid) Less(i, j int) bool { return s[i].Uuid < s[j].Uuid }
+
+// sessionsAdmin serves GET /sessions, GET/PUT/DELETE /sessions/{id} and the journal
+// of a session under /sessions/{id}/.
+func sessionsAdmin(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(sessionsPath, "/")), "/")
+	sessionUuid, action := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		sessionUuid, action = path[:i], path[i+1:]
+	}
+	if sessionUuid == "" {
+		if r.Method != http.MethodGet {
+			return respMethodNotAllowed(w, r)
+		}
+		return listSessions(w)
+	}
+
+	session, found := LocalStore.GetSession(sessionUuid)
+	if !found {
+		return respSessionNotFound(w, sessionUuid)
+	}
+
+	if action != "" {
+		return journalAdmin(w, r, session, action)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return respJson(w, http.StatusOK, newSessionInfo(session))
+	case http.MethodPut:
+		return updateSession(w, r, session, collection)
+	case http.MethodDelete:
+		if err := LocalStore.DeleteSession(session.Uuid); err != nil {
+			return respInternalServerError(w, err)
+		}
+		LocalJournal.Clear(session.Uuid)
+		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent
+	default:
+		return respMethodNotAllowed(w, r)
+	}
+}
+
+func listSessions(w http.ResponseWriter) int {
+	sessions := LocalStore.Sessions()
+	sort.Sort(sessionsByUuid(sessions))
+
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, newSessionInfo(session))
+	}
+	return respJson(w, http.StatusOK, infos)
+}
+
+// updateSession replaces the template (request body) and optionally the ttl and
+// response options (see parseSessionOptions) of the session. Cached renders of the old template are dropped.
+func updateSession(w http.ResponseWriter, r *http.Request, session *Session, collection *generator.RandomDataCollection) int {
+	userTpl, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	defer r.Body.Close()
+
+	updated := *session
+	if len(userTpl) > 0 {
+		updated.Template = string(userTpl)
+	}
+	if err := parseSessionOptions(r, &updated); err != nil {
+		return respInvalidOption(w, err)
+	}
+	if errs := validateSession(&updated, collection); errs != nil {
+		return respInvalidTemplate(w, errs)
+	}
+
+	ttl := ttlUntil(session.ExpiresAt)
+	if r.URL.Query().Get(formKeySessionTtlMin) != "" {
+		if ttl, err = parseTtlMin(r); err != nil {
+			return respInvalidTtl(w, err)
+		}
+	}
+
+	if err := LocalStore.SetSession(&updated, ttl); err != nil {
+		return respInternalServerError(w, err)
+	}
+	if err := LocalStore.DeleteResults(updated.Uuid); err != nil {
+		return respInternalServerError(w, err)
+	}
+	return respJson(w, http.StatusOK, newSessionInfo(&updated))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionsAdmin(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(nil,
+		Route{path: "/init", hand: initSession},
+		Route{path: sessionsPath, hand: sessionsAdmin, prefix: true},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init/?content_type=text/plain", strings.NewReader("old")))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/sessions/"+sessionResp.Session+"?session_ttl_min=5", strings.NewReader("new")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status expected %d; actual %d", http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sessions/"+sessionResp.Session, nil))
+	var info SessionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("GET response %q: %v", w.Body.String(), err)
+	}
+	if info.Template != "new" || info.ContentType != "text/plain" {
+		t.Errorf("session expected template 'new' and content type 'text/plain'; actual %+v", info)
+	}
+	if info.TtlSeconds <= 0 || info.TtlSeconds > 5*60 {
+		t.Errorf("ttl_seconds expected in (0, 300]; actual %d", info.TtlSeconds)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sessions", nil))
+	var infos []SessionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil || len(infos) != 1 {
+		t.Fatalf("GET /sessions expected one session; actual %q (%v)", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/sessions/"+sessionResp.Session, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status expected %d; actual %d", http.StatusNoContent, w.Code)
+	}
+	if _, found := LocalStore.GetSession(sessionResp.Session); found {
+		t.Error("session found after DELETE")
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const datasetPath = "/dataset"
+
+const (
+	formKeyColumn        = "column"
+	formKeyRows          = "rows"
+	formKeyDatasetFormat = "format"
+	formKeyDialect       = "dialect"
+	formKeyTable         = "table"
+	formKeyBatch         = "batch"
+)
+
+// Dataset formats.
+const (
+	datasetCsv    = "csv"
+	datasetNdjson = "ndjson"
+	datasetSql    = "sql"
+)
+
+// SQL dialects of INSERT statements.
+const (
+	dialectPostgres = "postgres"
+	dialectMysql    = "mysql"
+	dialectSqlite   = "sqlite"
+	dialectMssql    = "mssql"
+)
+
+const (
+	defaultDatasetRows  = 100
+	defaultDatasetTable = "data"
+	// defaultInsertBatch rows per INSERT, the most SQL Server accepts
+	defaultInsertBatch = 1000
+)
+
+var datasetContentTypes = map[string]string{
+	datasetCsv:    "text/csv; charset=utf-8",
+	datasetNdjson: "application/x-ndjson",
+	datasetSql:    "application/sql",
+}
+
+// DatasetOptions are the options of a dataset export shared by the CLI and /dataset.
+type DatasetOptions struct {
+	Rows    int
+	Format  string
+	Dialect string
+	Table   string
+	Batch   int
+	Seed    string
+}
+
+func newDatasetOptions() *DatasetOptions {
+	return &DatasetOptions{
+		Rows:    defaultDatasetRows,
+		Format:  datasetCsv,
+		Dialect: dialectPostgres,
+		Table:   defaultDatasetTable,
+		Batch:   defaultInsertBatch,
+	}
+}
+
+func (o *DatasetOptions) check() error {
+	if o.Rows < 0 {
+		return fmt.Errorf("invalid rows %d", o.Rows)
+	}
+	if _, ok := datasetContentTypes[o.Format]; !ok {
+		return fmt.Errorf("invalid format %q, expected csv, ndjson or sql", o.Format)
+	}
+	switch o.Dialect {
+	case dialectPostgres, dialectMysql, dialectSqlite, dialectMssql:
+	default:
+		return fmt.Errorf("invalid dialect %q, expected postgres, mysql, sqlite or mssql", o.Dialect)
+	}
+	if o.Table == "" {
+		return fmt.Errorf("table is empty")
+	}
+	if o.Batch < 1 {
+		return fmt.Errorf("invalid batch %d", o.Batch)
+	}
+	if o.Seed == "" {
+		o.Seed = getHash()
+	}
+	return nil
+}
+
+// parseDatasetQuery applies query parameters of /dataset to opts.
+func parseDatasetQuery(q url.Values, opts *DatasetOptions) error {
+	for _, key := range []string{formKeyRows, formKeyBatch} {
+		raw := q.Get(key)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", key, raw)
+		}
+		if key == formKeyRows {
+			opts.Rows = n
+		} else {
+			opts.Batch = n
+		}
+	}
+	if raw := q.Get(formKeyDatasetFormat); raw != "" {
+		opts.Format = raw
+	}
+	if raw := q.Get(formKeyDialect); raw != "" {
+		opts.Dialect = raw
+	}
+	if raw := q.Get(formKeyTable); raw != "" {
+		opts.Table = raw
+	}
+	opts.Seed = q.Get(formKeySeed)
+	return opts.check()
+}
+
+// datasetWriter writes rows in a format, header and footer wrap the rows.
+type datasetWriter interface {
+	header(columns []*generator.Column) error
+	row(n int, values []interface{}) error
+	footer() error
+	// flush writes rows buffered by the writer
+	flush() error
+}
+
+func newDatasetWriter(w io.Writer, opts *DatasetOptions) datasetWriter {
+	switch opts.Format {
+	case datasetNdjson:
+		return &ndjsonWriter{w: w}
+	case datasetSql:
+		return &sqlWriter{w: w, opts: opts}
+	}
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// writeDataset streams opts.Rows rows of the dataset to w; flush (if not nil) is
+// called after every batch of rows.
+func writeDataset(w io.Writer, dataset *generator.Dataset, opts *DatasetOptions, flush func() error) error {
+	buf := bufio.NewWriter(w)
+	dw := newDatasetWriter(buf, opts)
+	if err := dw.header(dataset.Columns); err != nil {
+		return err
+	}
+	for n := 1; n <= opts.Rows; n++ {
+		if err := dw.row(n, dataset.Row(n)); err != nil {
+			return err
+		}
+		if n%opts.Batch == 0 {
+			if err := dw.flush(); err != nil {
+				return err
+			}
+			if err := buf.Flush(); err != nil {
+				return err
+			}
+			if flush != nil {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := dw.footer(); err != nil {
+		return err
+	}
+	if err := dw.flush(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+func formatDatasetValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvWriter) header(columns []*generator.Column) error {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return cw.w.Write(names)
+}
+
+func (cw *csvWriter) row(n int, values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatDatasetValue(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) footer() error {
+	return nil
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []*generator.Column
+}
+
+func (nw *ndjsonWriter) header(columns []*generator.Column) error {
+	nw.columns = columns
+	return nil
+}
+
+func (nw *ndjsonWriter) row(n int, values []interface{}) error {
+	// written by hand to keep columns in the spec order
+	io.WriteString(nw.w, "{")
+	for i, v := range values {
+		if i > 0 {
+			io.WriteString(nw.w, ",")
+		}
+		name, _ := json.Marshal(nw.columns[i].Name)
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		nw.w.Write(name)
+		io.WriteString(nw.w, ":")
+		nw.w.Write(value)
+	}
+	_, err := io.WriteString(nw.w, "}\n")
+	return err
+}
+
+func (nw *ndjsonWriter) footer() error {
+	return nil
+}
+
+func (nw *ndjsonWriter) flush() error {
+	return nil
+}
+
+// sqlWriter writes INSERT statements of opts.Batch rows.
+type sqlWriter struct {
+	w      io.Writer
+	opts   *DatasetOptions
+	insert string
+	open   bool
+}
+
+func (sw *sqlWriter) header(columns []*generator.Column) error {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdentifier(sw.opts.Dialect, c.Name)
+	}
+	sw.insert = fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdentifier(sw.opts.Dialect, sw.opts.Table), strings.Join(names, ", "))
+	return nil
+}
+
+func (sw *sqlWriter) row(n int, values []interface{}) error {
+	if !sw.open {
+		io.WriteString(sw.w, sw.insert)
+		sw.open = true
+	} else {
+		io.WriteString(sw.w, ",\n")
+	}
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = sqlLiteral(sw.opts.Dialect, v)
+	}
+	_, err := fmt.Fprintf(sw.w, "(%s)", strings.Join(literals, ", "))
+	if err == nil && n%sw.opts.Batch == 0 {
+		err = sw.footer()
+	}
+	return err
+}
+
+func (sw *sqlWriter) footer() error {
+	if !sw.open {
+		return nil
+	}
+	sw.open = false
+	_, err := io.WriteString(sw.w, ";\n")
+	return err
+}
+
+func (sw *sqlWriter) flush() error {
+	return nil
+}
+
+// quoteIdentifier quotes a table or column name, a.b names are quoted by parts.
+func quoteIdentifier(dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		switch dialect {
+		case dialectMysql:
+			parts[i] = "`" + strings.Replace(part, "`", "``", -1) + "`"
+		case dialectMssql:
+			parts[i] = "[" + strings.Replace(part, "]", "]]", -1) + "]"
+		default:
+			parts[i] = `"` + strings.Replace(part, `"`, `""`, -1) + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func sqlLiteral(dialect string, v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if dialect == dialectPostgres {
+			return strings.ToUpper(strconv.FormatBool(v))
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int64, float64:
+		return formatDatasetValue(v)
+	}
+	s := strings.Replace(formatDatasetValue(v), "'", "''", -1)
+	if dialect == dialectMysql {
+		// MySQL treats backslashes in strings as escapes
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+	if dialect == dialectMssql {
+		return "N'" + s + "'"
+	}
+	return "'" + s + "'"
+}
+
+// datasetColumns parses column query parameters, or the body if there are none.
+func datasetColumns(r *http.Request) ([]*generator.Column, error) {
+	if specs, ok := r.URL.Query()[formKeyColumn]; ok {
+		columns := make([]*generator.Column, 0, len(specs))
+		for _, spec := range specs {
+			c, err := generator.ParseColumn(spec)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, c)
+		}
+		return columns, nil
+	}
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	return generator.ParseColumns(string(body))
+}
+
+// datasetExport serves GET/POST /dataset: columns are column=name: Function(args)
+// query parameters or lines of the body, rows are streamed as they're generated.
+func datasetExport(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return respMethodNotAllowed(w, r)
+	}
+	opts := newDatasetOptions()
+	if err := parseDatasetQuery(r.URL.Query(), opts); err != nil {
+		return respInvalidOption(w, err)
+	}
+	columns, err := datasetColumns(r)
+	if err != nil {
+		return respError(w, http.StatusBadRequest, errCodeBadRequest, err.Error(), nil)
+	}
+	dataset, err := generator.NewDataset(columns, opts.Seed, collection)
+	if err != nil {
+		return respError(w, http.StatusBadRequest, errCodeBadRequest, err.Error(), nil)
+	}
+
+	w.Header().Set("Content-Type", datasetContentTypes[opts.Format])
+	w.Header().Set(hashHeader, opts.Seed)
+	setCorsHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	err = writeDataset(w, dataset, opts, func() error {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		// stop generating for clients gone away
+		return r.Context().Err()
+	})
+	if err != nil {
+		log.Printf("dataset: %v", err)
+	}
+	return http.StatusOK
+}
+
+// runDataset exports a dataset from the command line:
+//
+//	mock-ass dataset -column 'name: FullNameChain' -column 'age: NumberChain(18, 90)' -rows 100000 -format sql
+func runDataset(args []string, stdout, stderr io.Writer) error {
+	opts := newDatasetOptions()
+	var specs columnFlags
+	var columnsFile, out, data string
+	flags := flag.NewFlagSet("dataset", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&specs, formKeyColumn, "column spec 'name: Function(args)', may be repeated")
+	flags.StringVar(&columnsFile, "columns", "", "file of column specs, one per line")
+	flags.IntVar(&opts.Rows, formKeyRows, opts.Rows, "number of rows")
+	flags.StringVar(&opts.Format, formKeyDatasetFormat, opts.Format, "csv, ndjson or sql")
+	flags.StringVar(&opts.Dialect, formKeyDialect, opts.Dialect, "SQL dialect: postgres, mysql, sqlite or mssql")
+	flags.StringVar(&opts.Table, formKeyTable, opts.Table, "SQL table name")
+	flags.IntVar(&opts.Batch, formKeyBatch, opts.Batch, "rows per SQL INSERT statement")
+	flags.StringVar(&opts.Seed, formKeySeed, "", "seed of the data, the same seed gives the same rows (a new seed if empty)")
+	flags.StringVar(&out, "out", "", "output file (stdout if empty)")
+	flags.StringVar(&data, "data", dataPath, "data collection directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	var columns []*generator.Column
+	if columnsFile != "" {
+		spec, err := ioutil.ReadFile(columnsFile)
+		if err != nil {
+			return err
+		}
+		if columns, err = generator.ParseColumns(string(spec)); err != nil {
+			return fmt.Errorf("%s: %v", columnsFile, err)
+		}
+	}
+	for _, spec := range specs {
+		c, err := generator.ParseColumn(spec)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, c)
+	}
+	collection, err := generator.InitCollectionFromPath(data)
+	if err != nil {
+		return err
+	}
+	dataset, err := generator.NewDataset(columns, opts.Seed, collection)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return writeDataset(stdout, dataset, opts, nil)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := writeDataset(f, dataset, opts, nil); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// columnFlags collects repeated -column flags.
+type columnFlags []string
+
+func (f *columnFlags) String() string {
+	return strings.Join(*f, "; ")
+}
+
+func (f *columnFlags) Set(spec string) error {
+	*f = append(*f, spec)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDatasetExport(t *testing.T) {
+	handler := newAppHandler(initTestCollection(t), Route{path: datasetPath, hand: datasetExport})
+	export := func(method, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, datasetPath+"?"+query, strings.NewReader(body)))
+		return w
+	}
+
+	spec := "id: Row\nname: FullNameChain\nage: NumberChain(18, 90)\n"
+	w := export(http.MethodPost, "rows=250&seed=abc", spec)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || w.Header().Get(hashHeader) != "abc" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 251 || strings.Join(records[0], ",") != "id,name,age" || records[250][0] != "250" {
+		t.Errorf("a header and 250 rows expected; actual %d records: %v ... %v", len(records), records[0], records[len(records)-1])
+	}
+
+	q := url.Values{"column": {"id: Row", "name: FullNameChain", "age: NumberChain(18, 90)"}, "rows": {"250"}, "seed": {"abc"}, "format": {"ndjson"}}
+	ndjson := export(http.MethodGet, q.Encode(), "").Body.String()
+	lines := strings.Split(strings.TrimSuffix(ndjson, "\n"), "\n")
+	if len(lines) != 250 || !strings.HasPrefix(lines[0], `{"id":1,"name":"`+records[1][1]+`","age":`+records[1][2]+`}`) {
+		t.Errorf("NDJSON rows expected to match CSV rows of the same seed; actual %q", lines[0])
+	}
+
+	sql := export(http.MethodPost, "rows=3&batch=2&format=sql&dialect=mysql&table=app.users&seed=abc", "id: Row\nok: BooleanChain").Body.String()
+	insert := regexp.QuoteMeta("INSERT INTO `app`.`users` (`id`, `ok`) VALUES\n")
+	expected := regexp.MustCompile(`^` + insert + `\(1, [01]\),\n\(2, [01]\);\n` + insert + `\(3, [01]\);\n$`)
+	if !expected.MatchString(sql) {
+		t.Errorf("SQL expected to match %s; actual %q", expected, sql)
+	}
+
+	for _, query := range []string{"format=xml", "dialect=oracle", "rows=x", "batch=0"} {
+		if w := export(http.MethodPost, query, spec); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status expected %d; actual %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := export(http.MethodPost, "", "name: NoSuchChain"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown function: status expected %d; actual %d", http.StatusBadRequest, w.Code)
+	}
+	if w := export(http.MethodPost, "", "age: NumberChain(90, 18)"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid range: status expected %d; actual %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestSqlLiteral(t *testing.T) {
+	for _, c := range []struct {
+		dialect  string
+		v        interface{}
+		expected string
+	}{
+		{dialectPostgres, "O'Brien", `'O''Brien'`},
+		{dialectMysql, `a\b'c`, `'a\\b''c'`},
+		{dialectMssql, "x", `N'x'`},
+		{dialectPostgres, true, `TRUE`},
+		{dialectSqlite, false, `0`},
+		{dialectSqlite, 1.5, `1.5`},
+		{dialectSqlite, nil, `NULL`},
+	} {
+		if actual := sqlLiteral(c.dialect, c.v); actual != c.expected {
+			t.Errorf("%s %v: expected %s; actual %s", c.dialect, c.v, c.expected, actual)
+		}
+	}
+}
+
+func TestRunDataset(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-data", filepath.Join("..", "..", "data"), "-column", "id: Row", "-column", "city: CityChain",
+		"-rows", "2", "-format", "sql", "-dialect", "sqlite", "-table", "cities", "-seed", "abc"}
+	if err := runDataset(args, &stdout, &stderr); err != nil {
+		t.Fatalf("%v %s", err, stderr.String())
+	}
+	if out := stdout.String(); !strings.HasPrefix(out, "INSERT INTO \"cities\" (\"id\", \"city\") VALUES\n(1, '") || !strings.HasSuffix(out, "');\n") {
+		t.Errorf("one INSERT of 2 rows expected; actual %q", out)
+	}
+	if err := runDataset([]string{"-rows", "1"}, &stdout, &stderr); err == nil {
+		t.Errorf("no columns: error expected")
+	}
+	args = []string{"-data", filepath.Join("..", "..", "data"), "-column", "age: NumberChain(5, 5)"}
+	if err := runDataset(args, &stdout, &stderr); err == nil {
+		t.Errorf("invalid range: error expected")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay distributions.
+const (
+	delayFixed     = "fixed"
+	delayUniform   = "uniform"
+	delayNormal    = "normal"
+	delayLogNormal = "lognormal"
+	delayPareto    = "pareto"
+)
+
+// maxDelay caps long-tail distributions.
+const maxDelay = 60 * time.Second
+
+const formKeyDelay = "delay"
+
+// Delay is a simulated response latency. Its text form is one of
+//
+//	300ms                      fixed
+//	uniform(100ms, 500ms)      uniform between min and max
+//	normal(300ms, 50ms)        normal with mean and standard deviation
+//	lognormal(200ms, 0.5)      log-normal with median and sigma
+//	pareto(100ms, 1.5)         Pareto with scale (minimum) and shape alpha
+type Delay struct {
+	Distribution string
+	// Value is the fixed delay, uniform min, normal mean, log-normal median or Pareto scale.
+	Value time.Duration
+	// Spread is the uniform max or normal standard deviation.
+	Spread time.Duration
+	// Shape is the log-normal sigma or Pareto alpha.
+	Shape float64
+}
+
+func parseDelay(s string) (*Delay, error) {
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "(")
+	if open < 0 {
+		value, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		d := &Delay{Distribution: delayFixed, Value: value}
+		return d, d.validate()
+	}
+	if !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("invalid delay %q: missing ')'", s)
+	}
+
+	d := &Delay{Distribution: strings.ToLower(strings.TrimSpace(s[:open]))}
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+
+	var err error
+	switch d.Distribution {
+	case delayFixed:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("invalid delay %q: expected fixed(value)", s)
+		}
+		d.Value, err = time.ParseDuration(args[0])
+	case delayUniform, delayNormal:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid delay %q: expected %s(duration, duration)", s, d.Distribution)
+		}
+		if d.Value, err = time.ParseDuration(args[0]); err == nil {
+			d.Spread, err = time.ParseDuration(args[1])
+		}
+	case delayLogNormal, delayPareto:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid delay %q: expected %s(duration, number)", s, d.Distribution)
+		}
+		if d.Value, err = time.ParseDuration(args[0]); err == nil {
+			d.Shape, err = strconv.ParseFloat(args[1], 64)
+		}
+	default:
+		return nil, fmt.Errorf("invalid delay %q: unknown distribution %q", s, d.Distribution)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid delay %q: %v", s, err)
+	}
+	return d, d.validate()
+}
+
+func (d *Delay) validate() error {
+	if d.Value < 0 || d.Spread < 0 {
+		return fmt.Errorf("invalid delay %s: negative duration", d)
+	}
+	switch d.Distribution {
+	case delayUniform:
+		if d.Spread < d.Value {
+			return fmt.Errorf("invalid delay %s: max is less than min", d)
+		}
+	case delayLogNormal, delayPareto:
+		if d.Shape <= 0 {
+			return fmt.Errorf("invalid delay %s: shape must be positive", d)
+		}
+	}
+	return nil
+}
+
+func (d *Delay) String() string {
+	switch d.Distribution {
+	case delayUniform, delayNormal:
+		return fmt.Sprintf("%s(%s, %s)", d.Distribution, d.Value, d.Spread)
+	case delayLogNormal, delayPareto:
+		return fmt.Sprintf("%s(%s, %s)", d.Distribution, d.Value, strconv.FormatFloat(d.Shape, 'g', -1, 64))
+	default:
+		return d.Value.String()
+	}
+}
+
+func (d *Delay) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Delay) UnmarshalText(text []byte) error {
+	parsed, err := parseDelay(string(text))
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+// Duration draws a delay from the distribution.
+func (d *Delay) Duration(r *rand.Rand) time.Duration {
+	var v float64
+	switch d.Distribution {
+	case delayUniform:
+		v = float64(d.Value) + r.Float64()*float64(d.Spread-d.Value)
+	case delayNormal:
+		v = float64(d.Value) + r.NormFloat64()*float64(d.Spread)
+	case delayLogNormal:
+		v = float64(d.Value) * math.Exp(d.Shape*r.NormFloat64())
+	case delayPareto:
+		v = float64(d.Value) / math.Pow(1-r.Float64(), 1/d.Shape)
+	default:
+		v = float64(d.Value)
+	}
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v > float64(maxDelay) {
+		return maxDelay
+	}
+	return time.Duration(v)
+}
+
+func hashSeed(hash string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(hash))
+	return int64(h.Sum64())
+}
+
+// simulateDelay sleeps for the session delay drawn with the hash as a seed,
+// so repeated fetches of the same hash take the same time.
+func simulateDelay(r *http.Request, session *Session, hash string) time.Duration {
+	if session.Delay == nil {
+		return 0
+	}
+	delay := session.Delay.Duration(rand.New(rand.NewSource(hashSeed(hash))))
+	if delay <= 0 {
+		return 0
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	return delay
+}
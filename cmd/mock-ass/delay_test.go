@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseDelay(t *testing.T) {
+	cases := map[string]string{
+		"300ms":                 "300ms",
+		"fixed(1s)":             "1s",
+		"uniform(100ms,500ms)":  "uniform(100ms, 500ms)",
+		"Normal(300ms, 50ms)":   "normal(300ms, 50ms)",
+		"lognormal(200ms, 0.5)": "lognormal(200ms, 0.5)",
+		"pareto(100ms, 1.5)":    "pareto(100ms, 1.5)",
+	}
+	for raw, expected := range cases {
+		d, err := parseDelay(raw)
+		if err != nil {
+			t.Errorf("%s: expected err is nil, but %+v", raw, err)
+			continue
+		}
+		if d.String() != expected {
+			t.Errorf("%s: expected %s; actual %s", raw, expected, d)
+		}
+	}
+
+	for _, raw := range []string{"", "soon", "uniform(500ms, 100ms)", "normal(1s)", "pareto(1s, 0)", "gamma(1s, 2)", "uniform(1s, 2s"} {
+		if _, err := parseDelay(raw); err == nil {
+			t.Errorf("%q: expected err, but is nil", raw)
+		}
+	}
+}
+
+func TestDelayJson(t *testing.T) {
+	session := Session{Delay: &Delay{Distribution: delayUniform, Value: time.Second, Spread: 2 * time.Second}}
+	b, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Session
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Delay == nil || *restored.Delay != *session.Delay {
+		t.Errorf("delay expected %v; actual %v", session.Delay, restored.Delay)
+	}
+}
+
+func TestDelayDuration(t *testing.T) {
+	uniform := &Delay{Distribution: delayUniform, Value: 100 * time.Millisecond, Spread: 500 * time.Millisecond}
+	pareto := &Delay{Distribution: delayPareto, Value: 100 * time.Millisecond, Shape: 1.1}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if d := uniform.Duration(r); d < uniform.Value || d > uniform.Spread {
+			t.Fatalf("uniform delay %v out of [%v, %v]", d, uniform.Value, uniform.Spread)
+		}
+		if d := pareto.Duration(r); d < pareto.Value || d > maxDelay {
+			t.Fatalf("pareto delay %v out of [%v, %v]", d, pareto.Value, maxDelay)
+		}
+	}
+
+	normal := &Delay{Distribution: delayNormal, Value: time.Second, Spread: 100 * time.Millisecond}
+	first := normal.Duration(rand.New(rand.NewSource(hashSeed("hash"))))
+	second := normal.Duration(rand.New(rand.NewSource(hashSeed("hash"))))
+	if first != second {
+		t.Errorf("delays for the same hash expected to be equal; actual %v and %v", first, second)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Faults a FaultPolicy can inject.
+const (
+	faultError     = "error"
+	faultReset     = "reset"
+	faultTruncate  = "truncate"
+	faultMalformed = "malformed"
+)
+
+const faultHeader = "X-Mock-Ass-Fault"
+
+const (
+	formKeyFaultError       = "fault_error"
+	formKeyFaultErrorStatus = "fault_error_status"
+	formKeyFaultReset       = "fault_reset"
+	formKeyFaultTruncate    = "fault_truncate"
+	formKeyFaultMalformed   = "fault_malformed"
+)
+
+// malformedTail is appended to the first half of a malformed body.
+const malformedTail = "\x00<!-- malformed -->{\"\n"
+
+// FaultPolicy holds probabilities of faults injected instead of a normal response.
+// The probabilities are exclusive, so their sum must not exceed 1.
+type FaultPolicy struct {
+	// Error responds with ErrorStatus and an empty body.
+	Error float64 `json:"error,omitempty" yaml:"error,omitempty"`
+	// ErrorStatus is http.StatusInternalServerError if zero.
+	ErrorStatus int `json:"error_status,omitempty" yaml:"error_status,omitempty"`
+	// Reset drops the TCP connection without a response.
+	Reset float64 `json:"reset,omitempty" yaml:"reset,omitempty"`
+	// Truncate closes the connection in the middle of the body.
+	Truncate float64 `json:"truncate,omitempty" yaml:"truncate,omitempty"`
+	// Malformed replaces the second half of the body with garbage.
+	Malformed float64 `json:"malformed,omitempty" yaml:"malformed,omitempty"`
+}
+
+func (p *FaultPolicy) validate() error {
+	sum := 0.0
+	for _, probability := range []float64{p.Error, p.Reset, p.Truncate, p.Malformed} {
+		if probability < 0 || probability > 1 {
+			return fmt.Errorf("fault probability %v out of [0, 1]", probability)
+		}
+		sum += probability
+	}
+	if sum > 1 {
+		return fmt.Errorf("sum of fault probabilities %v is greater than 1", sum)
+	}
+	if p.ErrorStatus != 0 && (p.ErrorStatus < 500 || p.ErrorStatus > 599) {
+		return fmt.Errorf("fault error status %d is not 5xx", p.ErrorStatus)
+	}
+	return nil
+}
+
+// pick returns the fault to inject or an empty string for a normal response.
+func (p *FaultPolicy) pick(r *rand.Rand) string {
+	if p == nil {
+		return ""
+	}
+	u := r.Float64()
+	for _, fault := range []struct {
+		name        string
+		probability float64
+	}{
+		{faultError, p.Error},
+		{faultReset, p.Reset},
+		{faultTruncate, p.Truncate},
+		{faultMalformed, p.Malformed},
+	} {
+		if u < fault.probability {
+			return fault.name
+		}
+		u -= fault.probability
+	}
+	return ""
+}
+
+// parseFaultPolicy parses fault_* query parameters; found is false if there are none.
+func parseFaultPolicy(r *http.Request) (policy *FaultPolicy, found bool, err error) {
+	q := r.URL.Query()
+	policy = new(FaultPolicy)
+	for key, probability := range map[string]*float64{
+		formKeyFaultError:     &policy.Error,
+		formKeyFaultReset:     &policy.Reset,
+		formKeyFaultTruncate:  &policy.Truncate,
+		formKeyFaultMalformed: &policy.Malformed,
+	} {
+		if raw := q.Get(key); raw != "" {
+			found = true
+			if *probability, err = strconv.ParseFloat(raw, 64); err != nil {
+				return nil, true, fmt.Errorf("invalid %s: %v", key, err)
+			}
+		}
+	}
+	if raw := q.Get(formKeyFaultErrorStatus); raw != "" {
+		found = true
+		if policy.ErrorStatus, err = strconv.Atoi(raw); err != nil {
+			return nil, true, fmt.Errorf("invalid %s: %v", formKeyFaultErrorStatus, err)
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	return policy, true, policy.validate()
+}
+
+var faultRand = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// serveWithFault decides on a fault of policy before serve renders anything
+// and injects it into the response. The decision goes to the log and faultHeader.
+func serveWithFault(w http.ResponseWriter, r *http.Request, policy *FaultPolicy, serve func(http.ResponseWriter) int) int {
+	if r.Method == http.MethodOptions {
+		return serve(w)
+	}
+	fault := policy.pick(faultRand)
+	if fault == "" {
+		return serve(w)
+	}
+
+	log.Printf("[%s] %s — inject fault %s", r.Method, r.URL.String(), fault)
+	w.Header().Set(faultHeader, fault)
+	switch fault {
+	case faultError:
+		statusCode := policy.ErrorStatus
+		if statusCode == 0 {
+			statusCode = http.StatusInternalServerError
+		}
+		setCorsHeaders(w)
+		w.WriteHeader(statusCode)
+		return statusCode
+	case faultReset:
+		closeConnection(w, true)
+		return 0
+	default:
+		fw := &faultWriter{ResponseWriter: w, fault: fault}
+		statusCode := serve(fw)
+		fw.finish()
+		return statusCode
+	}
+}
+
+// closeConnection drops the client connection, with a TCP RST where possible
+// if reset is set.
+func closeConnection(w http.ResponseWriter, reset bool) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok && reset {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// faultWriter buffers the body written by a handler and writes it corrupted
+// by finish. Event streams and hijacked (WebSocket) connections are passed
+// through untouched.
+type faultWriter struct {
+	http.ResponseWriter
+	fault      string
+	statusCode int
+	body       bytes.Buffer
+	// passThrough is set for streamed and hijacked responses
+	passThrough bool
+}
+
+func (fw *faultWriter) WriteHeader(statusCode int) {
+	if fw.passThrough {
+		fw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	// delay the header until the body length is known
+	fw.statusCode = statusCode
+}
+
+func (fw *faultWriter) Write(p []byte) (int, error) {
+	if !fw.passThrough && fw.body.Len() == 0 && isEventStream(fw.Header()) {
+		fw.Header().Del(faultHeader)
+		fw.passThrough = true
+		if fw.statusCode != 0 {
+			fw.ResponseWriter.WriteHeader(fw.statusCode)
+		}
+	}
+	if fw.passThrough {
+		return fw.ResponseWriter.Write(p)
+	}
+	return fw.body.Write(p)
+}
+
+// Flush passes flushes of event streams through, other responses are
+// written at once by finish.
+func (fw *faultWriter) Flush() {
+	if !fw.passThrough {
+		return
+	}
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes the connection through, for WebSocket upgrades.
+func (fw *faultWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	fw.passThrough = true
+	return hijacker.Hijack()
+}
+
+// isEventStream reports whether header is the one of a Server-Sent Events response.
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// finish writes the delayed header and the corrupted body.
+func (fw *faultWriter) finish() {
+	if fw.passThrough {
+		return
+	}
+	if fw.body.Len() == 0 {
+		if fw.statusCode != 0 {
+			fw.ResponseWriter.WriteHeader(fw.statusCode)
+		}
+		return
+	}
+	if fw.statusCode == 0 {
+		fw.statusCode = http.StatusOK
+	}
+
+	body := fw.body.Bytes()
+	half := body[:len(body)/2]
+	switch fw.fault {
+	case faultTruncate:
+		// announce the whole body and close the connection after the first half
+		fw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		fw.ResponseWriter.WriteHeader(fw.statusCode)
+		fw.ResponseWriter.Write(half)
+		if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		// a FIN, not a RST, the client may drop received data on a reset
+		closeConnection(fw.ResponseWriter, false)
+	case faultMalformed:
+		fw.Header().Del("Content-Length")
+		fw.ResponseWriter.WriteHeader(fw.statusCode)
+		fw.ResponseWriter.Write(append(append([]byte{}, half...), malformedTail...))
+	}
+}
+
+// lockedSource makes a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
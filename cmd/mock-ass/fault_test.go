@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+const faultTestBody = `{"name": "value", "list": [1, 2, 3]}`
+
+func newFaultTestServer(policy *FaultPolicy) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithFault(w, r, policy, func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(faultTestBody))
+			return http.StatusOK
+		})
+	}))
+}
+
+func TestFaultError(t *testing.T) {
+	ts := newFaultTestServer(&FaultPolicy{Error: 1, ErrorStatus: http.StatusServiceUnavailable})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status expected %d; actual %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if fault := resp.Header.Get(faultHeader); fault != faultError {
+		t.Errorf("%s expected %q; actual %q", faultHeader, faultError, fault)
+	}
+}
+
+func TestFaultReset(t *testing.T) {
+	ts := newFaultTestServer(&FaultPolicy{Reset: 1})
+	defer ts.Close()
+
+	if resp, err := http.Get(ts.URL); err == nil {
+		resp.Body.Close()
+		t.Error("expected connection error, but got response")
+	}
+}
+
+func TestFaultTruncate(t *testing.T) {
+	ts := newFaultTestServer(&FaultPolicy{Truncate: 1})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if fault := resp.Header.Get(faultHeader); fault != faultTruncate {
+		t.Errorf("%s expected %q; actual %q", faultHeader, faultTruncate, fault)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		t.Error("expected read error of truncated body, but is nil")
+	}
+	if string(body) != faultTestBody[:len(faultTestBody)/2] {
+		t.Errorf("body expected %q; actual %q", faultTestBody[:len(faultTestBody)/2], body)
+	}
+}
+
+func TestFaultMalformed(t *testing.T) {
+	ts := newFaultTestServer(&FaultPolicy{Malformed: 1})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(body), malformedTail) || string(body) == faultTestBody {
+		t.Errorf("body expected to be malformed; actual %q", body)
+	}
+}
+
+func TestFaultSeveralWrites(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithFault(w, r, &FaultPolicy{Malformed: 1}, func(w http.ResponseWriter) int {
+			for _, c := range faultTestBody {
+				w.Write([]byte(string(c)))
+			}
+			return http.StatusOK
+		})
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := faultTestBody[:len(faultTestBody)/2] + malformedTail; string(body) != expected {
+		t.Errorf("body expected %q; actual %q", expected, body)
+	}
+}
+
+func TestFaultStreams(t *testing.T) {
+	policy := &FaultPolicy{Truncate: 0.5, Malformed: 0.5}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithFault(w, r, policy, func(w http.ResponseWriter) int {
+			if websocket.IsWebSocketUpgrade(r) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return http.StatusBadRequest
+				}
+				defer conn.Close()
+				conn.WriteMessage(websocket.TextMessage, []byte(faultTestBody))
+				return http.StatusSwitchingProtocols
+			}
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				t.Error("fault writer expected to be a http.Flusher")
+				return http.StatusInternalServerError
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 1; i <= 2; i++ {
+				fmt.Fprintf(w, "data: %s\n\n", faultTestBody)
+				flusher.Flush()
+			}
+			return http.StatusOK
+		})
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("event stream: %v", err)
+		}
+		if expected := strings.Repeat("data: "+faultTestBody+"\n\n", 2); string(body) != expected {
+			t.Errorf("event stream expected %q; actual %q", expected, body)
+		}
+		if fault := resp.Header.Get(faultHeader); fault != "" {
+			t.Errorf("event stream: %s expected empty; actual %q", faultHeader, fault)
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+		if err != nil {
+			t.Fatalf("websocket: %v", err)
+		}
+		_, message, err := conn.ReadMessage()
+		conn.Close()
+		if err != nil || string(message) != faultTestBody {
+			t.Errorf("websocket message expected %q; actual %q, %v", faultTestBody, message, err)
+		}
+	}
+}
+
+func TestFaultPolicyPick(t *testing.T) {
+	policy := &FaultPolicy{Error: 0.25, Reset: 0.25, Truncate: 0.25}
+	counts := map[string]int{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		counts[policy.pick(r)]++
+	}
+	for _, fault := range []string{faultError, faultReset, faultTruncate, ""} {
+		if counts[fault] < 2000 || counts[fault] > 3000 {
+			t.Errorf("fault %q picked %d times of 10000, expected about 2500", fault, counts[fault])
+		}
+	}
+	if counts[faultMalformed] != 0 {
+		t.Errorf("fault %q picked %d times, expected 0", faultMalformed, counts[faultMalformed])
+	}
+
+	if err := (&FaultPolicy{Error: 0.6, Reset: 0.6}).validate(); err == nil {
+		t.Error("expected err for sum of probabilities > 1, but is nil")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+// formKeyGraphQL marks the request body as a GraphQL schema (SDL) instead of a template.
+const formKeyGraphQL = "graphql"
+
+const graphqlPath = "/graphql"
+
+func parseGraphQLFlag(raw string) (bool, error) {
+	graphql, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", formKeyGraphQL, raw)
+	}
+	return graphql, nil
+}
+
+// validateGraphQL checks the session schema parses.
+func validateGraphQL(session *Session) []*ValidationError {
+	if _, err := generator.ParseGraphQLSchema(session.Template); err != nil {
+		return []*ValidationError{{TemplateError: generator.AsTemplateError(err)}}
+	}
+	return nil
+}
+
+// readGraphQLRequest reads a GraphQL request the way clients send it: query,
+// operationName and variables (JSON) query parameters of GET requests, a JSON
+// body or an application/graphql body with the query of POST requests.
+func readGraphQLRequest(r *http.Request) (*generator.GraphQLRequest, error) {
+	req := new(generator.GraphQLRequest)
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if raw := q.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				return nil, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Body.Close()
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("invalid request: %v", err)
+		}
+	}
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+	return req, nil
+}
+
+// serveGraphQL answers a GraphQL request with data generated from the session
+// schema; the same seed (a new one if empty) gives the same data.
+func serveGraphQL(w http.ResponseWriter, r *http.Request, session *Session, seed string, collection *generator.RandomDataCollection) int {
+	schema, err := generator.ParseGraphQLSchema(session.Template)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	setCorsHeaders(w)
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+		return http.StatusOK
+	default:
+		return respMethodNotAllowed(w, r)
+	}
+	req, err := readGraphQLRequest(r)
+	if err != nil {
+		return respJson(w, http.StatusBadRequest, &generator.GraphQLResponse{
+			Errors: []*generator.GraphQLError{{Message: err.Error()}},
+		})
+	}
+	if seed == "" {
+		seed = requestSeed(r)
+	}
+	if seed == "" {
+		seed = getHash()
+	}
+
+	simulateDelay(r, session, seed)
+	resp := schema.Execute(req, seed, collection)
+	LocalScenarios.transit(session)
+	w.Header().Set(hashHeader, seed)
+	return respJson(w, http.StatusOK, resp)
+}
+
+// graphqlEndpoint serves GET/POST /graphql?s=<session>[&h=<seed>] of GraphQL sessions.
+func graphqlEndpoint(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	sessionUuid := r.URL.Query().Get("s")
+	session, found := LocalStore.GetSession(sessionUuid)
+	if !found {
+		return respSessionNotFound(w, sessionUuid)
+	}
+	if !session.GraphQL {
+		return respError(w, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("session %s is not a GraphQL session", session.Uuid), nil)
+	}
+	if !LocalScenarios.isActive(session) {
+		return respScenarioInactive(w, session)
+	}
+	return serveGraphQL(w, r, session, r.URL.Query().Get("h"), collection)
+}
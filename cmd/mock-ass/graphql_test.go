@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServeGraphQL(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+		Route{path: graphqlPath, hand: graphqlEndpoint, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?graphql=true",
+		strings.NewReader("type Query {\n  user: Person\n}")))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"line":2`) {
+		t.Errorf("unknown type expected to be rejected with its line; actual %d %s", w.Code, w.Body.String())
+	}
+
+	sdl := "type Query { users(first: Int): [User] }\ntype User { id: ID! firstName: String age: Int }"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?graphql=true", strings.NewReader(sdl)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	query := func(r *http.Request) (string, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d %s", r.Method, r.URL, w.Code, w.Body.String())
+		}
+		return w.Body.String(), w.Header().Get(hashHeader)
+	}
+	body := `{"query": "query Users($n: Int) { users(first: $n) { id firstName } }", "variables": {"n": 2}}`
+	out, seed := query(httptest.NewRequest(http.MethodPost, graphqlPath+"?s="+sessionResp.Session, strings.NewReader(body)))
+	var resp struct {
+		Data struct {
+			Users []struct{ Id, FirstName string }
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("response %q: %v", out, err)
+	}
+	if len(resp.Data.Users) != 2 || resp.Data.Users[0].FirstName == "" {
+		t.Errorf("2 users with names expected; actual %s", out)
+	}
+
+	// the seed replays the data, GET requests have the query in parameters
+	q := url.Values{"query": {"{ users(first: 2) { id firstName } }"}, "h": {seed}}
+	if again, _ := query(httptest.NewRequest(http.MethodGet, sessionResp.Url+"&"+q.Encode(), nil)); again != out {
+		t.Errorf("responses of the same seed differ:\n%s\n%s", out, again)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, graphqlPath+"?s="+sessionResp.Session, strings.NewReader("{ users { email } }"))
+	r.Header.Set("Content-Type", "application/graphql")
+	if out, _ := query(r); !strings.Contains(out, `Cannot query field \"email\" on type \"User\".`) {
+		t.Errorf("unknown field error expected; actual %s", out)
+	}
+}
@@ -7,11 +7,10 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/wolfmetr/mock-ass/generator"
-
-	"github.com/pmylund/go-cache"
 )
 
 const sessionUrl string = "/session/?s=%s"
@@ -25,6 +24,8 @@ const (
 	formKeyTemplate      = "template"
 	formKeyContentType   = "content_type"
 	formKeySessionTtlMin = "session_ttl_min"
+	formKeyStatus        = "status"
+	formKeyHeader        = "header"
 )
 
 type SessionResponse struct {
@@ -39,14 +40,38 @@ func newSessionResponse(sessionUuid string) *SessionResponse {
 	}
 }
 
+// Codes of error responses.
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeInvalidOption    = "invalid_option"
+	errCodeInvalidTemplate  = "invalid_template"
+	errCodeSessionNotFound  = "session_not_found"
+	errCodeHashNotFound     = "hash_not_found"
+	errCodeNotFound         = "not_found"
+	errCodeScenarioInactive = "scenario_inactive"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeRenderFailed     = "render_failed"
+	errCodeBadGateway       = "bad_gateway"
+	errCodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body of error responses: Code is one of errCode*, Details
+// are specific to the code, e.g. template errors of invalid_template.
 type ErrorResponse struct {
-	ErrorMsg string `json:"error_message"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
-var LocalCache *cache.Cache
+var LocalStore SessionStore
 
 func init() {
-	LocalCache = cache.New(60*time.Minute, 30*time.Second)
+	LocalStore = newMemoryStore()
+}
+
+// sessionFromQuery is the session of /session requests.
+func sessionFromQuery(r *http.Request) string {
+	return r.URL.Query().Get("s")
 }
 
 func getHash() string {
@@ -57,30 +82,86 @@ func getHash() string {
 	return hash
 }
 
-func getCacheHashKey(hash string) string {
-	return fmt.Sprintf("hash_%s", hash)
-}
-func getCacheCtKey(sessionUuid string) string {
-	return fmt.Sprintf("ct_%s", sessionUuid)
-}
+// renderSession renders the session template and its header templates with the same hash.
+func renderSession(session *Session, hash string, r *http.Request, params map[string]string, collection *generator.RandomDataCollection) (*Result, error) {
+	ctx := map[string]interface{}{
+		"request": newTemplateRequest(r, params),
+	}
+	render := sessionRenderer(session, r)
+	var out string
+	var err error
+	if session.Schema {
+		out, err = renderSchema(session, hash, collection)
+	} else {
+		out, err = render(session.Template, hash, collection, ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Format != "" {
+		if out, err = formatOutput(outputKind(session.ContentType), out, session.Format); err != nil {
+			log.Printf("session %s: %v, the output isn't formatted", session.Uuid, err)
+		}
+	}
 
-func getContentTypeFromCache(sessionUuid, fallback string) string {
-	if contentTypeRaw, found := LocalCache.Get(getCacheCtKey(sessionUuid)); found {
-		return contentTypeRaw.(string)
+	result := &Result{
+		Session: session.Uuid,
+		Hash:    hash,
+		Body:    out,
+		Status:  session.Status,
 	}
-	return fallback
+	if len(session.Headers) > 0 {
+		result.Headers = make(map[string]string, len(session.Headers))
+		for name, tpl := range session.Headers {
+			value, err := render(tpl, hash, collection, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %v", name, err)
+			}
+			result.Headers[name] = value
+		}
+	}
+	return result, nil
 }
 
-func responseFromCache(w http.ResponseWriter, hash, result, sessionUuid string) int {
-	LocalCache.Set(getCacheHashKey(hash), result, defaultDataTtlMinutes)
+// setHeader sets a rendered header; a value of several lines is sent as
+// a header per line, e.g. several Set-Cookie headers.
+func setHeader(header http.Header, name, value string) {
+	header.Del(name)
+	for _, line := range strings.Split(value, "\n") {
+		header.Add(name, strings.TrimSuffix(line, "\r"))
+	}
+}
 
-	contentType := getContentTypeFromCache(sessionUuid, defaultContentType)
-	LocalCache.Set(getCacheCtKey(sessionUuid), contentType, defaultDataTtlMinutes)
+// writeResult writes the rendered result with the session content type.
+func writeResult(w http.ResponseWriter, result *Result, session *Session) int {
+	contentType := session.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
 
 	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(hashHeader, result.Hash)
 	setCorsHeaders(w)
-	io.WriteString(w, result)
-	return http.StatusOK
+	for name, value := range result.Headers {
+		setHeader(w.Header(), name, value)
+	}
+
+	statusCode := result.Status
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	io.WriteString(w, result.Body)
+	return statusCode
+}
+
+func responseFromCache(w http.ResponseWriter, r *http.Request, result *Result, session *Session) int {
+	simulateDelay(r, session, result.Hash)
+	if err := LocalStore.SetResult(result, defaultDataTtlMinutes); err != nil {
+		log.Println(err.Error())
+	}
+	return writeResult(w, result, session)
 }
 
 func responseRedirect(w http.ResponseWriter, r *http.Request, sessionUuid, hash string) int {
@@ -91,6 +172,7 @@ func responseRedirect(w http.ResponseWriter, r *http.Request, sessionUuid, hash
 	urlRedirect.RawQuery = q.Encode()
 
 	w.Header().Set("Location", urlRedirect.String())
+	w.Header().Set(hashHeader, hash)
 	setCorsHeaders(w)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 	return http.StatusTemporaryRedirect
@@ -100,37 +182,60 @@ func generateRespGetMethod(w http.ResponseWriter, r *http.Request, collection *g
 	hash := r.FormValue("h")
 	sessionUuid := r.FormValue("s")
 	if sessionUuid == "" {
-		log.Println("session argument empty or not found")
-		w.WriteHeader(http.StatusBadRequest)
-		return http.StatusBadRequest
+		return respError(w, http.StatusBadRequest, errCodeBadRequest, "session argument s is empty", nil)
 	}
 
-	var found bool
-	var userTplC interface{}
-	if userTplC, found = LocalCache.Get(sessionUuid); !found {
-		w.WriteHeader(http.StatusBadRequest)
-		return http.StatusUnauthorized
+	session, found := LocalStore.GetSession(sessionUuid)
+	if !found {
+		return respSessionNotFound(w, sessionUuid)
 	}
 	if hash != "" {
-		if result, found := LocalCache.Get(getCacheHashKey(hash)); found {
-			return responseFromCache(w, hash, result.(string), sessionUuid)
+		// cached renders were made in the required state, the scenario may have moved on since
+		if result, found := LocalStore.GetResult(hash); found && result.Session == session.Uuid {
+			return responseFromCache(w, r, result, session)
 		}
-		// TODO: invalid hash response?
-		w.WriteHeader(http.StatusBadRequest)
-		return http.StatusUnauthorized
-
+	}
+	if !LocalScenarios.isActive(session) {
+		return respScenarioInactive(w, session)
+	}
+	// the hash (or the seed parameter) is the seed of streams and GraphQL responses
+	if session.GraphQL {
+		return serveGraphQL(w, r, session, hash, collection)
+	}
+	if isWebSocketRequest(r, session) {
+		return serveWebSocket(w, r, session, nil, hash, collection)
+	}
+	if session.Stream != nil {
+		return serveEvents(w, r, session, nil, hash, collection)
+	}
+	if seed := requestSeed(r); seed != "" && hash == "" {
+		// seeded renders are reproducible, they're served without caching and redirects
+		simulateDelay(r, session, seed)
+		result, err := renderSession(session, seed, r, nil, collection)
+		if err != nil {
+			return respRenderError(w, err)
+		}
+		LocalScenarios.transit(session)
+		return writeResult(w, result, session)
+	}
+	if hash != "" {
+		return respError(w, http.StatusNotFound, errCodeHashNotFound,
+			fmt.Sprintf("hash %s of session %s not found or expired", hash, session.Uuid),
+			map[string]string{"session": session.Uuid, "hash": hash})
 	}
 
 	// generate resp from template
 	hash = getHash()
 
-	userTpl := userTplC.(string)
-	out, err := generator.Render(userTpl, hash, collection)
+	result, err := renderSession(session, hash, r, nil, collection)
 	if err != nil {
-		return respInternalServerError(w, err)
+		return respRenderError(w, err)
 	}
 	// set resp to cache
-	LocalCache.Set(getCacheHashKey(hash), out, defaultDataTtlMinutes)
+	if err := LocalStore.SetResult(result, defaultDataTtlMinutes); err != nil {
+		return respInternalServerError(w, err)
+	}
+	LocalScenarios.transit(session)
 
 	// and redirect to stable url
 	return responseRedirect(w, r, sessionUuid, hash)
@@ -140,10 +245,15 @@ func generateRespPostMethod(w http.ResponseWriter, r *http.Request, collection *
 	userTpl := r.FormValue(formKeyTemplate)
 	contentType := parseContentType(r)
 
-	hash := getHash()
-	out, err := generator.Render(userTpl, hash, collection)
+	render, hash := generator.RenderWithContext, getHash()
+	if seed := requestSeed(r); seed != "" {
+		render, hash = generator.RenderDeterministic, seed
+	}
+	out, err := render(userTpl, hash, collection, map[string]interface{}{
+		"request": newTemplateRequest(r, nil),
+	})
 	if err != nil {
-		return respInternalServerError(w, err)
+		return respRenderError(w, err)
 	}
 
 	w.Header().Set("Content-Type", contentType)
@@ -165,20 +275,17 @@ func generateResp(w http.ResponseWriter, r *http.Request, collection *generator.
 		io.WriteString(w, "")
 		return http.StatusOK
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return http.StatusMethodNotAllowed
+		return respMethodNotAllowed(w, r)
 	}
 }
 
-func initSession(w http.ResponseWriter, r *http.Request, _ *generator.RandomDataCollection) int {
+func initSession(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return http.StatusMethodNotAllowed
+		return respMethodNotAllowed(w, r)
 	}
 
 	r.ParseForm()
 
-	contentType := parseContentType(r)
 	userTpl, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return respInternalServerError(w, err)
@@ -187,23 +294,26 @@ func initSession(w http.ResponseWriter, r *http.Request, _ *generator.RandomData
 
 	ttl, err := parseTtlMin(r)
 	if err != nil {
-		return respInternalServerError(w, err)
+		return respInvalidTtl(w, err)
 	}
 	sessionUuid := getHash()
 
-	LocalCache.Set(sessionUuid, string(userTpl), ttl)
-	LocalCache.Set(getCacheCtKey(sessionUuid), contentType, ttl)
-
-	sessionResp := newSessionResponse(sessionUuid)
-	sessionRespJson, err := json.Marshal(sessionResp)
-	if err != nil {
+	session := &Session{
+		Uuid:        sessionUuid,
+		Template:    string(userTpl),
+		ContentType: defaultContentType,
+	}
+	if err := parseSessionOptions(r, session); err != nil {
+		return respInvalidOption(w, err)
+	}
+	if errs := validateSession(session, collection); errs != nil {
+		return respInvalidTemplate(w, errs)
+	}
+	if err := LocalStore.SetSession(session, ttl); err != nil {
 		return respInternalServerError(w, err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(sessionRespJson)
-	return http.StatusOK
-
+	return respJson(w, http.StatusOK, newSessionResponse(sessionUuid))
 }
 
 func setCorsHeaders(w http.ResponseWriter) {
@@ -212,10 +322,61 @@ func setCorsHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 }
 
+func respJson(w http.ResponseWriter, statusCode int, v interface{}) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(b)
+	return statusCode
+}
+
+// respError logs the error and writes it as an ErrorResponse.
+func respError(w http.ResponseWriter, statusCode int, code, message string, details interface{}) int {
+	log.Printf("%s: %s", code, message)
+	return respJson(w, statusCode, &ErrorResponse{Code: code, Message: message, Details: details})
+}
+
 func respInternalServerError(w http.ResponseWriter, err error) int {
+	message := http.StatusText(http.StatusInternalServerError)
 	if err != nil {
-		log.Println(err.Error())
+		message = err.Error()
 	}
-	w.WriteHeader(http.StatusInternalServerError)
-	return http.StatusInternalServerError
+	return respError(w, http.StatusInternalServerError, errCodeInternal, message, nil)
+}
+
+// respRenderError responds to a failed render, details are the template error.
+func respRenderError(w http.ResponseWriter, err error) int {
+	terr := generator.AsTemplateError(err)
+	return respError(w, http.StatusInternalServerError, errCodeRenderFailed, "render failed: "+terr.Error(), terr)
+}
+
+// respInvalidOption responds to an invalid query parameter (or definition field).
+func respInvalidOption(w http.ResponseWriter, err error) int {
+	return respError(w, http.StatusBadRequest, errCodeInvalidOption, err.Error(), nil)
+}
+
+func respInvalidTtl(w http.ResponseWriter, err error) int {
+	return respError(w, http.StatusBadRequest, errCodeInvalidOption,
+		fmt.Sprintf("invalid %s: %v", formKeySessionTtlMin, err), map[string]string{"option": formKeySessionTtlMin})
+}
+
+func respMethodNotAllowed(w http.ResponseWriter, r *http.Request) int {
+	return respError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed,
+		fmt.Sprintf("method %s is not allowed for %s", r.Method, r.URL.Path), nil)
+}
+
+func respSessionNotFound(w http.ResponseWriter, uuid string) int {
+	return respError(w, http.StatusNotFound, errCodeSessionNotFound,
+		fmt.Sprintf("session %s not found or expired", uuid), map[string]string{"session": uuid})
+}
+
+// respScenarioInactive responds to a request for a session waiting for another scenario state.
+func respScenarioInactive(w http.ResponseWriter, session *Session) int {
+	return respError(w, http.StatusNotFound, errCodeScenarioInactive,
+		fmt.Sprintf("session %s waits for scenario %s state %s", session.Uuid, session.Scenario, session.RequiredState),
+		map[string]string{"scenario": session.Scenario, "required_state": session.RequiredState, "state": LocalScenarios.State(session.Scenario)})
 }
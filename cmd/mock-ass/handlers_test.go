@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponses(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init", strings.NewReader(`{"name": "{{ FullName() }}"}`)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	renderQuery := url.Values{formKeyTemplate: {"{{ FirstName( }}"}}.Encode()
+	panicQuery := url.Values{formKeyTemplate: {"{{ Number(5, 5) }}"}}.Encode()
+	cases := []struct {
+		method, path string
+		body         string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/session/?s=unknown", "", http.StatusNotFound, errCodeSessionNotFound},
+		{http.MethodGet, sessionResp.Url + "&h=expired", "", http.StatusNotFound, errCodeHashNotFound},
+		{http.MethodGet, "/session/", "", http.StatusBadRequest, errCodeBadRequest},
+		{http.MethodPost, "/init?session_ttl_min=x", "{}", http.StatusBadRequest, errCodeInvalidOption},
+		{http.MethodPost, "/init?session_ttl_min=-1", "{}", http.StatusBadRequest, errCodeInvalidOption},
+		{http.MethodPost, "/init?status=999", "{}", http.StatusBadRequest, errCodeInvalidOption},
+		{http.MethodPost, "/init", "{{ FristName() }}", http.StatusBadRequest, errCodeInvalidTemplate},
+		{http.MethodPost, "/session/?" + renderQuery, "", http.StatusInternalServerError, errCodeRenderFailed},
+		{http.MethodPost, "/session/?" + panicQuery, "", http.StatusInternalServerError, errCodeRenderFailed},
+		{http.MethodDelete, "/init", "", http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound, errCodeNotFound},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+		var resp ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s %s: error response expected; actual %q", c.method, c.path, w.Body.String())
+			continue
+		}
+		if w.Code != c.status || resp.Code != c.code || resp.Message == "" {
+			t.Errorf("%s %s: %d %s expected; actual %d %s", c.method, c.path, c.status, c.code, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJournalSize = 1000
+	// maxJournalBody is the part of request bodies kept in the journal
+	maxJournalBody = 64 << 10
+)
+
+// hashHeader reports the hash of the rendered response, it's also recorded in the journal.
+const hashHeader = "X-Mock-Ass-Hash"
+
+const (
+	formKeyJournalMethod       = "method"
+	formKeyJournalPath         = "path"
+	formKeyJournalPathRegexp   = "path_regexp"
+	formKeyJournalHeader       = "header"
+	formKeyJournalQuery        = "query"
+	formKeyJournalBodyContains = "body_contains"
+	formKeyJournalSince        = "since"
+	formKeyVerifyCount         = "count"
+	formKeyVerifyMin           = "min"
+	formKeyVerifyMax           = "max"
+)
+
+// JournalEntry is a request received by a session.
+type JournalEntry struct {
+	Time    time.Time   `json:"time"`
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Path    string      `json:"path"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+	Hash    string      `json:"hash,omitempty"`
+	Route   string      `json:"route,omitempty"`
+	Status  int         `json:"status"`
+
+	query map[string][]string
+}
+
+func newJournalEntry(r *http.Request) *JournalEntry {
+	entry := &JournalEntry{
+		Time:    time.Now(),
+		Method:  r.Method,
+		Url:     r.URL.String(),
+		Path:    r.URL.Path,
+		Headers: r.Header,
+		query:   r.URL.Query(),
+	}
+	if r.Body != nil {
+		// only the journaled prefix is buffered, the handler reads it and the rest
+		body, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxJournalBody))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		entry.Body = string(body)
+	}
+	return entry
+}
+
+// Journal keeps the last requests of every session.
+type Journal struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string][]*JournalEntry
+}
+
+func newJournal(size int) *Journal {
+	return &Journal{
+		size:    size,
+		entries: make(map[string][]*JournalEntry),
+	}
+}
+
+var LocalJournal = newJournal(defaultJournalSize)
+
+func (j *Journal) Record(sessionUuid string, entry *JournalEntry) {
+	if j.size <= 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := append(j.entries[sessionUuid], entry)
+	if len(entries) > j.size {
+		entries = append([]*JournalEntry(nil), entries[len(entries)-j.size:]...)
+	}
+	j.entries[sessionUuid] = entries
+}
+
+// Entries returns the session requests matching filter, oldest first.
+func (j *Journal) Entries(sessionUuid string, filter *JournalFilter) []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	matched := make([]*JournalEntry, 0)
+	for _, entry := range j.entries[sessionUuid] {
+		if filter.match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+func (j *Journal) Clear(sessionUuid string) {
+	j.mu.Lock()
+	delete(j.entries, sessionUuid)
+	j.mu.Unlock()
+}
+
+// JournalFilter selects journal entries, empty fields match everything.
+type JournalFilter struct {
+	Method       string
+	Path         string
+	PathRegexp   *regexp.Regexp
+	Headers      map[string]string
+	Query        map[string]string
+	BodyContains string
+	Since        time.Time
+}
+
+func parseJournalFilter(r *http.Request) (*JournalFilter, error) {
+	q := r.URL.Query()
+	filter := &JournalFilter{
+		Method:       strings.ToUpper(q.Get(formKeyJournalMethod)),
+		Path:         q.Get(formKeyJournalPath),
+		Headers:      make(map[string]string),
+		Query:        make(map[string]string),
+		BodyContains: q.Get(formKeyJournalBodyContains),
+	}
+	if raw := q.Get(formKeyJournalPathRegexp); raw != "" {
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", formKeyJournalPathRegexp, err)
+		}
+		filter.PathRegexp = re
+	}
+	for _, raw := range q[formKeyJournalHeader] {
+		i := strings.Index(raw, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected 'Name: value'", raw)
+		}
+		filter.Headers[strings.TrimSpace(raw[:i])] = strings.TrimSpace(raw[i+1:])
+	}
+	for _, raw := range q[formKeyJournalQuery] {
+		i := strings.Index(raw, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid query %q, expected 'name=value'", raw)
+		}
+		filter.Query[raw[:i]] = raw[i+1:]
+	}
+	if raw := q.Get(formKeyJournalSince); raw != "" {
+		since, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", formKeyJournalSince, err)
+		}
+		filter.Since = since
+	}
+	return filter, nil
+}
+
+func (f *JournalFilter) match(entry *JournalEntry) bool {
+	if f == nil {
+		return true
+	}
+	if f.Method != "" && f.Method != entry.Method {
+		return false
+	}
+	if f.Path != "" && f.Path != entry.Path {
+		return false
+	}
+	if f.PathRegexp != nil && !f.PathRegexp.MatchString(entry.Path) {
+		return false
+	}
+	for name, value := range f.Headers {
+		if entry.Headers.Get(name) != value {
+			return false
+		}
+	}
+	for name, value := range f.Query {
+		values, ok := entry.query[name]
+		if !ok || !containsString(values, value) {
+			return false
+		}
+	}
+	if f.BodyContains != "" && !strings.Contains(entry.Body, f.BodyContains) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyResponse is the result of a /sessions/{id}/verify request.
+type VerifyResponse struct {
+	Ok       bool            `json:"ok"`
+	Matched  int             `json:"matched"`
+	Expected string          `json:"expected"`
+	Requests []*JournalEntry `json:"requests"`
+}
+
+// journalAdmin serves GET/DELETE /sessions/{id}/requests and GET /sessions/{id}/verify.
+func journalAdmin(w http.ResponseWriter, r *http.Request, session *Session, action string) int {
+	if action == "requests" && r.Method == http.MethodDelete {
+		LocalJournal.Clear(session.Uuid)
+		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent
+	}
+	if r.Method != http.MethodGet {
+		return respMethodNotAllowed(w, r)
+	}
+
+	filter, err := parseJournalFilter(r)
+	if err != nil {
+		return respInvalidOption(w, err)
+	}
+	entries := LocalJournal.Entries(session.Uuid, filter)
+
+	switch action {
+	case "requests":
+		return respJson(w, http.StatusOK, entries)
+	case "verify":
+		return verifyJournal(w, r, entries)
+	default:
+		return respError(w, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("unknown session action %q", action), nil)
+	}
+}
+
+// verifyJournal checks the number of matched requests: exactly `count`, or between
+// `min` and `max`; at least one request by default. Failed checks respond with 417.
+func verifyJournal(w http.ResponseWriter, r *http.Request, entries []*JournalEntry) int {
+	q := r.URL.Query()
+	minCount, maxCount := 1, -1
+	expected := "at least 1"
+	parseBound := func(key string) (int, error) {
+		n, err := strconv.Atoi(q.Get(key))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid %s %q", key, q.Get(key))
+		}
+		return n, nil
+	}
+
+	var err error
+	switch {
+	case q.Get(formKeyVerifyCount) != "":
+		if minCount, err = parseBound(formKeyVerifyCount); err == nil {
+			maxCount = minCount
+			expected = fmt.Sprintf("exactly %d", minCount)
+		}
+	case q.Get(formKeyVerifyMin) != "" || q.Get(formKeyVerifyMax) != "":
+		minCount = 0
+		if q.Get(formKeyVerifyMin) != "" {
+			minCount, err = parseBound(formKeyVerifyMin)
+		}
+		if err == nil && q.Get(formKeyVerifyMax) != "" {
+			maxCount, err = parseBound(formKeyVerifyMax)
+		}
+		expected = fmt.Sprintf("at least %d", minCount)
+		if maxCount >= 0 {
+			expected = fmt.Sprintf("between %d and %d", minCount, maxCount)
+		}
+	}
+	if err != nil {
+		return respInvalidOption(w, err)
+	}
+
+	matched := len(entries)
+	resp := &VerifyResponse{
+		Ok:       matched >= minCount && (maxCount < 0 || matched <= maxCount),
+		Matched:  matched,
+		Expected: expected,
+		Requests: entries,
+	}
+	if !resp.Ok {
+		return respJson(w, http.StatusExpectationFailed, resp)
+	}
+	return respJson(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pmylund/go-cache"
+)
+
+func TestJournalVerify(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalJournal = newJournal(2)
+	collection := initTestCollection(t)
+	handler := newAppHandler(collection,
+		Route{path: sessionsPath, hand: sessionsAdmin, prefix: true},
+	)
+
+	session := &Session{Uuid: "orders", Template: `{"id": "{{ request.params.id }}"}`}
+	LocalStore.SetSession(session, cache.NoExpiration)
+	LocalStore.SetRoute(&MockRoute{Id: "route", Path: "/orders/{id}", Match: matchPattern, Session: session.Uuid})
+
+	for _, body := range []string{`{"n": 1}`, `{"n": 2}`, `{"n": 3}`} {
+		r := httptest.NewRequest(http.MethodPost, "/orders/42?source=test", strings.NewReader(body))
+		r.Header.Set("X-Client", "tests")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/43", nil))
+
+	cases := []struct {
+		query      string
+		statusCode int
+		matched    int
+	}{
+		// the journal keeps the last 2 requests only
+		{"", http.StatusOK, 2},
+		{"?count=1&method=post", http.StatusOK, 1},
+		{"?count=1&body_contains=%22n%22:%203&header=X-Client:%20tests&query=source=test", http.StatusOK, 1},
+		{"?count=2&path=/orders/42", http.StatusExpectationFailed, 1},
+		{"?min=1&max=3&path_regexp=^/orders/4[23]$", http.StatusOK, 2},
+		{"?path=/unknown", http.StatusExpectationFailed, 0},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sessions/orders/verify"+c.query, nil))
+		if w.Code != c.statusCode {
+			t.Errorf("verify%s: status expected %d; actual %d", c.query, c.statusCode, w.Code)
+		}
+		var resp VerifyResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("verify%s: %v", c.query, err)
+			continue
+		}
+		if resp.Matched != c.matched {
+			t.Errorf("verify%s: matched expected %d; actual %d", c.query, c.matched, resp.Matched)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sessions/orders/requests?method=GET", nil))
+	var entries []*JournalEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 {
+		t.Fatalf("requests expected one GET entry; actual %q (%v)", w.Body.String(), err)
+	}
+	if entries[0].Route != "route" || entries[0].Hash == "" || entries[0].Status != http.StatusOK {
+		t.Errorf("entry expected with route, hash and status; actual %+v", entries[0])
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/sessions/orders/requests", nil))
+	if entries := LocalJournal.Entries("orders", nil); len(entries) != 0 {
+		t.Errorf("journal expected to be empty after DELETE; actual %d entries", len(entries))
+	}
+}
+
+func TestNewJournalEntryLargeBody(t *testing.T) {
+	large := strings.Repeat("a", maxJournalBody) + strings.Repeat("b", 100)
+	r := httptest.NewRequest(http.MethodPost, "/session/?s=large", strings.NewReader(large))
+	entry := newJournalEntry(r)
+	if entry.Body != large[:maxJournalBody] {
+		t.Errorf("journaled body expected the first %d bytes; actual %d bytes", maxJournalBody, len(entry.Body))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != large {
+		t.Errorf("request body expected intact, %d bytes; actual %d bytes", len(large), len(body))
+	}
+}
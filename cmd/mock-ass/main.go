@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/wolfmetr/mock-ass/generator"
 )
@@ -13,39 +19,179 @@ import (
 var (
 	flagColor = flag.Bool("color", false, "enable color output")
 	flagPort  = flag.Uint("port", 8000, "server start port")
+
+	flagStateDir    = flag.String("state-dir", "", "directory to persist sessions between restarts (in-memory only if empty)")
+	flagJournalSize = flag.Int("journal-size", defaultJournalSize, "number of requests kept in the journal of every session")
+	flagMocks       = flag.String("mocks", "", "directory of mock definition files (JSON or YAML) loaded at start")
+	flagMocksPoll   = flag.Duration("mocks-poll", defaultMocksPoll, "interval to check -mocks files for changes, 0 disables reloading")
+
+	flagProxy  = flag.String("proxy", "", "upstream URL to forward requests without a mock to, responses are recorded as mocks")
+	flagRecord = flag.String("record", "", "directory to write recorded mock definitions to (-mocks directory by default)")
+	flagInfer  = flag.Bool("infer", false, "infer templates of recorded JSON responses, replacing names, emails, numbers, etc. with functions")
+
+	flagOpenAPI = flag.String("openapi", "", "OpenAPI 3 document (JSON or YAML) to create a mock per operation from")
 )
 
 var dataPath string
 
+// shutdownTimeout limits waiting for in-flight requests on shutdown,
+// streams and WebSocket connections are cut after it.
+const shutdownTimeout = 5 * time.Second
+
+// subcommands run instead of the server, e.g. `mock-ass render -template t.json.tpl`.
+var subcommands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"render":  runRender,
+	"dataset": runDataset,
+}
+
 func init() {
 	dataPath = os.Getenv("MOCK_ASS_DATA_DIR")
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+				if err == flag.ErrHelp {
+					os.Exit(2)
+				}
+				log.Fatalf("%s error: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
 	flag.Parse()
 
+	LocalJournal = newJournal(*flagJournalSize)
+
 	collection, err := generator.InitCollectionFromPath(dataPath)
 	if err != nil {
 		log.Fatalf("InitCollectionFromPath error: %v", err)
 	}
 	log.Println("Data collection successfully loaded")
+
+	if *flagStateDir != "" {
+		store, err := newFileStore(*flagStateDir)
+		if err != nil {
+			log.Fatalf("newFileStore error: %v", err)
+		}
+		LocalStore = store
+		log.Printf("Sessions state loaded from %s", *flagStateDir)
+	}
+
+	if *flagMocks != "" {
+		LocalMocks = newMockLoader(*flagMocks, collection)
+		n, err := LocalMocks.Load()
+		if err != nil {
+			log.Fatalf("load mocks error: %v", err)
+		}
+		log.Printf("%d mocks loaded from %s", n, *flagMocks)
+		if *flagMocksPoll > 0 {
+			go LocalMocks.Watch(*flagMocksPoll, nil)
+		}
+	}
+
+	if *flagOpenAPI != "" {
+		data, err := ioutil.ReadFile(*flagOpenAPI)
+		if err != nil {
+			log.Fatalf("read openapi error: %v", err)
+		}
+		ops, err := LocalImports.Import(data)
+		if err != nil {
+			log.Fatalf("import openapi error: %v", err)
+		}
+		log.Printf("%d operations imported from %s", len(ops), *flagOpenAPI)
+	}
+
+	if *flagProxy != "" {
+		recordDir := *flagRecord
+		if recordDir == "" {
+			recordDir = *flagMocks
+		}
+		LocalRecorder, err = newRecorder(*flagProxy, recordDir, *flagInfer)
+		if err != nil {
+			log.Fatalf("newRecorder error: %v", err)
+		}
+		log.Printf("Proxy to %s, recording to %q", *flagProxy, recordDir)
+	}
+
 	server := http.Server{
 		Addr: fmt.Sprintf(":%d", *flagPort),
 		Handler: newAppHandler(
 			collection,
 			Route{
-				path: "/session",
-				hand: generateResp,
+				path:    "/session",
+				hand:    generateResp,
+				session: sessionFromQuery,
 			},
 			Route{
 				path: "/init",
 				hand: initSession,
 			},
+			Route{
+				path:   "/sessions/",
+				hand:   sessionsAdmin,
+				prefix: true,
+			},
+			Route{
+				path:   routesPath,
+				hand:   routesAdmin,
+				prefix: true,
+			},
+			Route{
+				path:   scenariosPath,
+				hand:   scenariosAdmin,
+				prefix: true,
+			},
+			Route{
+				path: validatePath,
+				hand: validateTemplate,
+			},
+			Route{
+				path: mocksStatusPath,
+				hand: mocksStatus,
+			},
+			Route{
+				path: openapiPath,
+				hand: openapiImport,
+			},
+			Route{
+				path: openapiExportPath,
+				hand: openapiExport,
+			},
+			Route{
+				path: datasetPath,
+				hand: datasetExport,
+			},
+			Route{
+				path:    graphqlPath,
+				hand:    graphqlEndpoint,
+				session: sessionFromQuery,
+			},
 		),
 	}
 
+	// on SIGINT or SIGTERM in-flight requests are finished and the store is closed
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("%v received, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("shutdown error: %v", err)
+		}
+	}()
+
 	log.Printf("Start server port %d", *flagPort)
-	if err := server.ListenAndServe(); err != nil {
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("serve error: %v", err)
 	}
+	<-stopped
+	if err := LocalStore.Close(); err != nil {
+		log.Fatalf("close store error: %v", err)
+	}
 }
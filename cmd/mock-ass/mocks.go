@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wolfmetr/mock-ass/generator"
+	"gopkg.in/yaml.v2"
+)
+
+// MockDefinition is a mock described in a file of the -mocks directory.
+// A file holds one definition or a list of them, in JSON or YAML.
+type MockDefinition struct {
+	// Id is the session UUID and the route id, the file name by default
+	// (with the list index for lists of definitions).
+	Id string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Path may be empty to serve the mock only via /session/?s={id}.
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	Match  string `json:"match,omitempty" yaml:"match,omitempty"`
+
+	ContentType string            `json:"content_type,omitempty" yaml:"content_type,omitempty"`
+	Status      int               `json:"status,omitempty" yaml:"status,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Template is the inline template, TemplateFile is a path to the template
+	// relative to the definition file.
+	Template     string `json:"template,omitempty" yaml:"template,omitempty"`
+	TemplateFile string `json:"template_file,omitempty" yaml:"template_file,omitempty"`
+	// Schema means the template is a JSON Schema responses are generated from.
+	Schema bool `json:"schema,omitempty" yaml:"schema,omitempty"`
+	// GraphQL means the template is a GraphQL schema (SDL) queries are answered from.
+	GraphQL bool `json:"graphql,omitempty" yaml:"graphql,omitempty"`
+	// Deterministic renders derive every value from the hash.
+	Deterministic bool `json:"deterministic,omitempty" yaml:"deterministic,omitempty"`
+
+	Format        string       `json:"format,omitempty" yaml:"format,omitempty"`
+	Delay         string       `json:"delay,omitempty" yaml:"delay,omitempty"`
+	Fault         *FaultPolicy `json:"fault,omitempty" yaml:"fault,omitempty"`
+	Scenario      string       `json:"scenario,omitempty" yaml:"scenario,omitempty"`
+	RequiredState string       `json:"required_state,omitempty" yaml:"required_state,omitempty"`
+	NewState      string       `json:"new_state,omitempty" yaml:"new_state,omitempty"`
+}
+
+// mock is a compiled definition; route is nil for definitions without a path.
+type mock struct {
+	session *Session
+	route   *MockRoute
+	// templateFile is the resolved TemplateFile path
+	templateFile string
+}
+
+func isMockFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// readMockDefinitions parses a definition file.
+func readMockDefinitions(path string) ([]*MockDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []*MockDefinition
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			err = json.Unmarshal(data, &defs)
+		} else {
+			def := new(MockDefinition)
+			err = json.Unmarshal(data, def)
+			defs = []*MockDefinition{def}
+		}
+	} else if err = yaml.Unmarshal(data, &defs); err != nil {
+		def := new(MockDefinition)
+		err = yaml.Unmarshal(data, def)
+		defs = []*MockDefinition{def}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// compile turns the definition into a session and a route; dir is the directory
+// of the definition file.
+func (d *MockDefinition) compile(dir string) (*mock, error) {
+	session := &Session{
+		Uuid:          d.Id,
+		Template:      d.Template,
+		ContentType:   d.ContentType,
+		Status:        d.Status,
+		Fault:         d.Fault,
+		Scenario:      d.Scenario,
+		RequiredState: d.RequiredState,
+		NewState:      d.NewState,
+		Schema:        d.Schema,
+		GraphQL:       d.GraphQL,
+		Deterministic: d.Deterministic,
+		OutputCheck:   d.ContentType != "",
+	}
+	if _, err := parseFormat(d.Format); err != nil {
+		return nil, err
+	}
+	session.Format = d.Format
+	if session.ContentType == "" {
+		session.ContentType = defaultContentType
+	}
+	var templateFile string
+	if d.TemplateFile != "" {
+		if d.Template != "" {
+			return nil, fmt.Errorf("both template and template_file are set")
+		}
+		path := d.TemplateFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		tpl, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		session.Template = string(tpl)
+		templateFile = path
+	}
+	if d.GraphQL {
+		if _, err := generator.ParseGraphQLSchema(session.Template); err != nil {
+			return nil, err
+		}
+	} else if d.Schema {
+		if _, err := generator.ParseSchema([]byte(session.Template)); err != nil {
+			return nil, err
+		}
+	} else if err := generator.Compile(session.Template); err != nil {
+		return nil, err
+	}
+	if d.Status != 0 && (d.Status < 200 || d.Status > 599) {
+		return nil, fmt.Errorf("invalid status code %d", d.Status)
+	}
+	if len(d.Headers) > 0 {
+		session.Headers = make(map[string]string, len(d.Headers))
+		for name, value := range d.Headers {
+			if err := generator.Compile(value); err != nil {
+				return nil, fmt.Errorf("header %s: %v", name, err)
+			}
+			session.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	if d.Delay != "" {
+		delay, err := parseDelay(d.Delay)
+		if err != nil {
+			return nil, err
+		}
+		session.Delay = delay
+	}
+	if d.Fault != nil {
+		if err := d.Fault.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &mock{session: session, templateFile: templateFile}
+	if d.Path != "" {
+		m.route = &MockRoute{
+			Id:         d.Id,
+			Method:     strings.ToUpper(d.Method),
+			Path:       d.Path,
+			Match:      d.Match,
+			Session:    session.Uuid,
+			OwnSession: true,
+		}
+		if m.route.Match == "" {
+			m.route.Match = defaultMatch(d.Path)
+		}
+		if err := m.route.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// loadMockFile compiles all definitions of a file and validates them with a trial
+// render, like sessions of /init. The mocks are transient: the file is read again
+// on start, so they aren't persisted.
+func loadMockFile(path string, collection *generator.RandomDataCollection) ([]*mock, error) {
+	defs, err := readMockDefinitions(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	ids := make(map[string]bool, len(defs))
+	mocks := make([]*mock, 0, len(defs))
+	for i, def := range defs {
+		if def == nil {
+			continue
+		}
+		if def.Id == "" {
+			def.Id = name
+			if len(defs) > 1 {
+				def.Id += "-" + strconv.Itoa(i+1)
+			}
+		}
+		if ids[def.Id] {
+			return nil, fmt.Errorf("%s: duplicate mock id %s", path, def.Id)
+		}
+		ids[def.Id] = true
+		m, err := def.compile(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: mock %s: %v", path, def.Id, err)
+		}
+		if errs := validateSession(m.session, collection); errs != nil {
+			return nil, fmt.Errorf("%s: mock %s: %s", path, def.Id, validationMessage(errs))
+		}
+		m.session.Transient = true
+		if m.route != nil {
+			m.route.Transient = true
+		}
+		mocks = append(mocks, m)
+	}
+	return mocks, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const mocksStatusPath string = "/mocks"
+
+const defaultMocksPoll = time.Second
+
+// fileStamp tells whether a file has changed since it was read.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// mockFile is the state of a definition file. mocks is the last good version,
+// it keeps serving while err is set.
+type mockFile struct {
+	mocks    []*mock
+	stamps   map[string]fileStamp
+	loadedAt time.Time
+	err      error
+}
+
+func (f *mockFile) changed() bool {
+	for path, stamp := range f.stamps {
+		if statFile(path) != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// MockFileStatus is a definition file in the GET /mocks response.
+type MockFileStatus struct {
+	File     string     `json:"file"`
+	Mocks    []string   `json:"mocks"`
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// MockLoader installs mocks of the -mocks directory and keeps them in sync with
+// the definition and template files.
+type MockLoader struct {
+	dir        string
+	collection *generator.RandomDataCollection
+	mu         sync.Mutex
+	files      map[string]*mockFile
+}
+
+func newMockLoader(dir string, collection *generator.RandomDataCollection) *MockLoader {
+	return &MockLoader{dir: dir, collection: collection, files: make(map[string]*mockFile)}
+}
+
+var LocalMocks *MockLoader
+
+// definitionFiles lists definition files of the directory, not of its
+// subdirectories, so templates can be kept in a subdirectory.
+func (l *MockLoader) definitionFiles() ([]string, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && isMockFile(file.Name()) {
+			paths = append(paths, filepath.Join(l.dir, file.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// readFile compiles and validates a definition file and stamps it with its templates.
+func (l *MockLoader) readFile(path string) *mockFile {
+	stamp := statFile(path)
+	mocks, err := loadMockFile(path, l.collection)
+	if err != nil {
+		return &mockFile{err: err}
+	}
+	f := &mockFile{
+		mocks:    mocks,
+		stamps:   map[string]fileStamp{path: stamp},
+		loadedAt: time.Now(),
+	}
+	for _, m := range mocks {
+		if m.templateFile != "" {
+			f.stamps[m.templateFile] = statFile(m.templateFile)
+		}
+	}
+	return f
+}
+
+// checkMockIds fails if a mock of f has the id of a mock of another file.
+func checkMockIds(files map[string]*mockFile, path string, f *mockFile) error {
+	for _, m := range f.mocks {
+		for otherPath, other := range files {
+			if otherPath == path {
+				continue
+			}
+			for _, o := range other.mocks {
+				if o.session.Uuid == m.session.Uuid {
+					return fmt.Errorf("%s: mock id %s is already used in %s", path, m.session.Uuid, otherPath)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Load installs all mocks of the directory. Nothing is installed if any of the files is broken.
+func (l *MockLoader) Load() (int, error) {
+	paths, err := l.definitionFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files := make(map[string]*mockFile, len(paths))
+	n := 0
+	for _, path := range paths {
+		f := l.readFile(path)
+		if f.err != nil {
+			return 0, f.err
+		}
+		if err := checkMockIds(files, path, f); err != nil {
+			return 0, err
+		}
+		files[path] = f
+		n += len(f.mocks)
+	}
+	for _, f := range files {
+		if err := swapMocks(nil, f.mocks); err != nil {
+			return 0, err
+		}
+	}
+	l.files = files
+	return n, nil
+}
+
+// Reload installs mocks of new and changed files and removes mocks of deleted files.
+// Broken files are logged and reported by Status, their last good mocks keep serving.
+func (l *MockLoader) Reload() {
+	paths, err := l.definitionFiles()
+	if err != nil {
+		log.Printf("mocks: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+		old := l.files[path]
+		// broken files are retried until they're fixed
+		if old != nil && old.err == nil && !old.changed() {
+			continue
+		}
+
+		var oldMocks []*mock
+		if old != nil {
+			oldMocks = old.mocks
+		}
+		f := l.readFile(path)
+		if f.err == nil {
+			f.err = checkMockIds(l.files, path, f)
+		}
+		if f.err == nil {
+			f.err = swapMocks(oldMocks, f.mocks)
+		}
+		if f.err != nil {
+			if old == nil || old.err == nil || old.err.Error() != f.err.Error() {
+				log.Printf("mocks: %v; the last good version keeps serving", f.err)
+			}
+			if old != nil {
+				f.mocks, f.stamps, f.loadedAt = old.mocks, old.stamps, old.loadedAt
+			}
+			l.files[path] = f
+			continue
+		}
+		log.Printf("mocks: %s loaded, %d mocks", path, len(f.mocks))
+		l.files[path] = f
+	}
+
+	for path, f := range l.files {
+		if seen[path] {
+			continue
+		}
+		if err := swapMocks(f.mocks, nil); err != nil {
+			log.Printf("mocks: %v", err)
+			continue
+		}
+		delete(l.files, path)
+		log.Printf("mocks: %s removed", path)
+	}
+}
+
+// Watch polls the directory every interval until stop is closed.
+func (l *MockLoader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.Reload()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Status reports the state of every definition file.
+func (l *MockLoader) Status() []*MockFileStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	statuses := make([]*MockFileStatus, 0, len(l.files))
+	for path, f := range l.files {
+		status := &MockFileStatus{File: path, Mocks: make([]string, 0, len(f.mocks))}
+		for _, m := range f.mocks {
+			status.Mocks = append(status.Mocks, m.session.Uuid)
+		}
+		if !f.loadedAt.IsZero() {
+			loadedAt := f.loadedAt
+			status.LoadedAt = &loadedAt
+		}
+		if f.err != nil {
+			status.Error = f.err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Sort(mockFilesByName(statuses))
+	return statuses
+}
+
+type mockFilesByName []*MockFileStatus
+
+func (s mockFilesByName) Len() int           { return len(s) }
+func (s mockFilesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s mockFilesByName) Less(i, j int) bool { return s[i].File < s[j].File }
+
+// swapMocks replaces the previous mocks of a file with the next ones in one
+// step of the store. Sessions are replaced in place, so their cached hashes are
+// dropped; mocks and routes gone from the file are removed.
+func swapMocks(prev, next []*mock) error {
+	sessions := make([]*Session, 0, len(next))
+	var routes []*MockRoute
+	nextSessions := make(map[string]bool, len(next))
+	nextRoutes := make(map[string]bool, len(next))
+	for _, m := range next {
+		sessions = append(sessions, m.session)
+		nextSessions[m.session.Uuid] = true
+		if m.route != nil {
+			routes = append(routes, m.route)
+			nextRoutes[m.route.Id] = true
+		}
+	}
+
+	var deleteSessions, deleteRoutes []string
+	for _, m := range prev {
+		if m.route != nil && !nextRoutes[m.route.Id] {
+			deleteRoutes = append(deleteRoutes, m.route.Id)
+		}
+		if !nextSessions[m.session.Uuid] {
+			deleteSessions = append(deleteSessions, m.session.Uuid)
+		}
+	}
+	return LocalStore.ReplaceMocks(sessions, routes, deleteSessions, deleteRoutes)
+}
+
+// mocksStatus serves GET /mocks with the state of definition files.
+func mocksStatus(w http.ResponseWriter, r *http.Request, _ *generator.RandomDataCollection) int {
+	if r.Method != http.MethodGet {
+		return respMethodNotAllowed(w, r)
+	}
+	if LocalMocks == nil {
+		return respJson(w, http.StatusOK, []*MockFileStatus{})
+	}
+	return respJson(w, http.StatusOK, LocalMocks.Status())
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadMocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"users.yaml": `
+- path: /users/{id}
+  method: get
+  template_file: templates/user.json
+- id: create-user
+  path: /users
+  method: POST
+  status: 201
+  headers:
+    location: /users/{{ hash }}
+  template: '{"id": "{{ hash }}"}'
+`,
+		"health.json":         `{"path": "/health", "content_type": "text/plain", "template": "ok"}`,
+		"templates/user.json": `{"id": "{{ request.params.id }}"}`,
+		"README.md":           "not a mock",
+	})
+
+	LocalStore = newMemoryStore()
+	n, err := newMockLoader(dir, initTestCollection(t)).Load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("mocks expected 3; actual %d", n)
+	}
+
+	handler := newAppHandler(initTestCollection(t))
+	cases := []struct {
+		method, path string
+		statusCode   int
+		body         string
+	}{
+		{http.MethodGet, "/users/42", http.StatusOK, `{"id": "42"}`},
+		{http.MethodGet, "/health", http.StatusOK, "ok"},
+		{http.MethodPost, "/users", http.StatusCreated, ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.statusCode {
+			t.Errorf("%s %s: status expected %d; actual %d", c.method, c.path, c.statusCode, w.Code)
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s %s: body expected %q; actual %q", c.method, c.path, c.body, w.Body.String())
+		}
+	}
+
+	if _, found := LocalStore.GetSession("users-1"); !found {
+		t.Error("session users-1 expected to be named after the file")
+	}
+	if session, _ := LocalStore.GetSession("create-user"); session == nil || session.Headers["Location"] == "" {
+		t.Errorf("session create-user expected to have a Location header; actual %+v", session)
+	}
+}
+
+func TestLoadMocksError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"good.json": `{"path": "/good", "template": "good"}`,
+		"bad.yaml":  "path: /bad\ntemplate_file: missing.json\n",
+	})
+
+	LocalStore = newMemoryStore()
+	if _, err := newMockLoader(dir, initTestCollection(t)).Load(); err == nil {
+		t.Fatal("Load expected to fail on a missing template file")
+	}
+	if routes := LocalStore.Routes(); len(routes) != 0 {
+		t.Errorf("no routes expected after a failed load; actual %d", len(routes))
+	}
+}
+
+func TestLoadMocksRenderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"users.yaml": "- id: user\n  path: /users/1\n  template: '{\"name\": \"{{ FristName() }}\"}'\n",
+	})
+
+	LocalStore = newMemoryStore()
+	_, err = newMockLoader(dir, initTestCollection(t)).Load()
+	if err == nil || !strings.Contains(err.Error(), "mock user: invalid template") || !strings.Contains(err.Error(), "FristName") {
+		t.Fatalf("Load expected to fail on an unknown function; actual %v", err)
+	}
+}
+
+func TestLoadMocksDuplicateId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"users.yaml": "- id: user\n  path: /users/1\n  template: one\n- id: user\n  path: /users/2\n  template: two\n",
+	})
+
+	LocalStore = newMemoryStore()
+	_, err = newMockLoader(dir, initTestCollection(t)).Load()
+	if err == nil || !strings.Contains(err.Error(), "duplicate mock id user") {
+		t.Fatalf("Load expected to fail on a duplicate id; actual %v", err)
+	}
+	if routes := LocalStore.Routes(); len(routes) != 0 {
+		t.Errorf("no routes expected after a failed load; actual %d", len(routes))
+	}
+}
+
+func TestMockLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"user.yaml":           "path: /user\ntemplate_file: templates/user.txt\n",
+		"templates/user.txt":  "v1",
+		"removed.json":        `{"path": "/removed", "template": "removed"}`,
+		"templates/other.txt": "other",
+	})
+
+	LocalStore = newMemoryStore()
+	loader := newMockLoader(dir, initTestCollection(t))
+	if _, err := loader.Load(); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	handler := newAppHandler(initTestCollection(t))
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	// a changed template
+	writeTestFiles(t, dir, map[string]string{"templates/user.txt": "version 2"})
+	loader.Reload()
+	if _, body := get("/user"); body != "version 2" {
+		t.Errorf("body after a template change expected %q; actual %q", "version 2", body)
+	}
+
+	// a broken definition keeps the last good version
+	writeTestFiles(t, dir, map[string]string{"user.yaml": "path: /user\ntemplate: '{{ broken'\n"})
+	loader.Reload()
+	if _, body := get("/user"); body != "version 2" {
+		t.Errorf("body after a broken change expected %q; actual %q", "version 2", body)
+	}
+	statuses := loader.Status()
+	if len(statuses) != 2 || statuses[1].Error == "" || len(statuses[1].Mocks) != 1 {
+		t.Errorf("status expected an error for user.yaml with the last good mock; actual %+v", statuses[1])
+	}
+
+	// fixed and removed definitions
+	writeTestFiles(t, dir, map[string]string{"user.yaml": "path: /user\ntemplate_file: templates/other.txt\n"})
+	os.Remove(filepath.Join(dir, "removed.json"))
+	loader.Reload()
+	if _, body := get("/user"); body != "other" {
+		t.Errorf("body after a fix expected %q; actual %q", "other", body)
+	}
+	if code, _ := get("/removed"); code != http.StatusNotFound {
+		t.Errorf("removed mock status expected %d; actual %d", http.StatusNotFound, code)
+	}
+	if statuses := loader.Status(); len(statuses) != 1 || statuses[0].Error != "" {
+		t.Errorf("status expected user.yaml only without errors; actual %+v", statuses)
+	}
+}
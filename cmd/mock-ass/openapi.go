@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wolfmetr/mock-ass/generator"
+	"gopkg.in/yaml.v2"
+)
+
+const openapiPath = "/openapi"
+
+// openapiMethods are the operations of a path item, other keys are ignored.
+var openapiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPI is the part of an OpenAPI 3 document mocks are imported from and exported to.
+type OpenAPI struct {
+	OpenAPI string       `json:"openapi"`
+	Info    *openapiInfo `json:"info,omitempty"`
+	Servers []struct {
+		Url string `json:"url"`
+	} `json:"servers,omitempty"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		// Schemas are kept raw to preserve the order of properties
+		Schemas   json.RawMessage             `json:"schemas,omitempty"`
+		Responses map[string]*openapiResponse `json:"responses,omitempty"`
+	} `json:"components"`
+}
+
+type openapiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openapiOperation struct {
+	OperationId string                      `json:"operationId,omitempty"`
+	Parameters  []*openapiParameter         `json:"parameters,omitempty"`
+	Responses   map[string]*openapiResponse `json:"responses"`
+}
+
+type openapiParameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required"`
+	Schema   json.RawMessage `json:"schema,omitempty"`
+}
+
+type openapiResponse struct {
+	Ref         string                       `json:"$ref,omitempty"`
+	Description string                       `json:"description"`
+	Headers     map[string]*openapiHeader    `json:"headers,omitempty"`
+	Content     map[string]*openapiMediaType `json:"content,omitempty"`
+}
+
+type openapiHeader struct {
+	Schema  json.RawMessage `json:"schema,omitempty"`
+	Example json.RawMessage `json:"example,omitempty"`
+}
+
+type openapiMediaType struct {
+	Schema   json.RawMessage `json:"schema,omitempty"`
+	Example  json.RawMessage `json:"example,omitempty"`
+	Examples map[string]*struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"examples,omitempty"`
+}
+
+// ImportedOperation describes a mock created for an OpenAPI operation.
+type ImportedOperation struct {
+	Id          string `json:"id"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Schema      bool   `json:"schema"`
+}
+
+// OpenAPIImports keeps the mocks of the last imported document,
+// they're replaced by the next import.
+type OpenAPIImports struct {
+	mu    sync.Mutex
+	mocks []*mock
+}
+
+var LocalImports = &OpenAPIImports{}
+
+// parseOpenAPI reads an OpenAPI 3 document in JSON or YAML.
+func parseOpenAPI(data []byte) (*OpenAPI, error) {
+	if trimmed := bytes.TrimSpace(data); !bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc yaml.MapSlice
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := writeYamlJson(&buf, doc); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+
+	spec := new(OpenAPI)
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q, expected 3.x", spec.OpenAPI)
+	}
+	return spec, nil
+}
+
+// writeYamlJson encodes a YAML value as JSON keeping the order of mapping keys.
+func writeYamlJson(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		buf.WriteByte('{')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(fmt.Sprint(item.Key))
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeYamlJson(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeYamlJson(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// basePath is the path of the first server URL, paths of the document are relative to it.
+func (spec *OpenAPI) basePath() string {
+	if len(spec.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(spec.Servers[0].Url)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// definitions turns every operation of the document into a mock definition.
+func (spec *OpenAPI) definitions() ([]*MockDefinition, error) {
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	base := spec.basePath()
+	var defs []*MockDefinition
+	for _, path := range paths {
+		for _, method := range openapiMethods {
+			raw, ok := spec.Paths[path][method]
+			if !ok {
+				continue
+			}
+			op := new(openapiOperation)
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", strings.ToUpper(method), path, err)
+			}
+			def, err := spec.definition(op, strings.ToUpper(method), base+path)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", strings.ToUpper(method), path, err)
+			}
+			defs = append(defs, def)
+		}
+	}
+	return defs, nil
+}
+
+func (spec *OpenAPI) definition(op *openapiOperation, method, path string) (*MockDefinition, error) {
+	def := &MockDefinition{
+		Id:     recordedMockId(method, path),
+		Method: method,
+		Path:   path,
+	}
+	if op.OperationId != "" {
+		def.Id = op.OperationId
+	}
+
+	code, status := pickResponse(op.Responses)
+	if code == "" {
+		return nil, fmt.Errorf("no responses")
+	}
+	def.Status = status
+	resp := op.Responses[code]
+	if resp.Ref != "" {
+		name := strings.TrimPrefix(resp.Ref, "#/components/responses/")
+		if resp = spec.Components.Responses[name]; resp == nil {
+			return nil, fmt.Errorf("unresolved $ref %q", op.Responses[code].Ref)
+		}
+	}
+
+	for name, header := range resp.Headers {
+		if header != nil && len(header.Example) > 0 {
+			if def.Headers == nil {
+				def.Headers = make(map[string]string)
+			}
+			def.Headers[name] = generator.Literal(exampleText(header.Example, false))
+		}
+	}
+
+	contentType := pickContentType(resp.Content)
+	if contentType == "" {
+		def.ContentType = "text/plain"
+		return def, nil
+	}
+	def.ContentType = contentType
+	media := resp.Content[contentType]
+	isJson := outputKind(contentType) == outputJson
+	if example := media.example(); len(example) > 0 {
+		def.Template = generator.Literal(exampleText(example, isJson))
+	} else if len(media.Schema) > 0 && isJson {
+		def.Template = spec.schemaDocument(media.Schema)
+		def.Schema = true
+	}
+	return def, nil
+}
+
+// pickResponse returns the response to mock and its status: the first 2xx, default
+// (as 200) or the first declared one.
+func pickResponse(responses map[string]*openapiResponse) (string, int) {
+	codes := make([]string, 0, len(responses))
+	for code, resp := range responses {
+		if resp != nil {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			return code, responseStatus(code)
+		}
+	}
+	if responses["default"] != nil {
+		return "default", http.StatusOK
+	}
+	for _, code := range codes {
+		if status := responseStatus(code); status != 0 {
+			return code, status
+		}
+	}
+	return "", 0
+}
+
+// responseStatus parses a response code like 201 or 2XX, it returns 0 for others.
+func responseStatus(code string) int {
+	if len(code) == 3 && strings.HasSuffix(strings.ToUpper(code), "XX") {
+		code = code[:1] + "00"
+	}
+	status, err := strconv.Atoi(code)
+	if err != nil || status < 100 || status > 599 {
+		return 0
+	}
+	return status
+}
+
+// pickContentType prefers JSON content, then the first content type by name.
+func pickContentType(content map[string]*openapiMediaType) string {
+	types := make([]string, 0, len(content))
+	for contentType, media := range content {
+		if media != nil {
+			types = append(types, contentType)
+		}
+	}
+	sort.Strings(types)
+	for _, contentType := range types {
+		if outputKind(contentType) == outputJson {
+			return contentType
+		}
+	}
+	if len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
+
+// example returns the example value, the first of examples by name if there are several.
+func (m *openapiMediaType) example() json.RawMessage {
+	if len(m.Example) > 0 {
+		return m.Example
+	}
+	names := make([]string, 0, len(m.Examples))
+	for name, example := range m.Examples {
+		if example != nil && len(example.Value) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return m.Examples[names[0]].Value
+}
+
+// exampleText is the response body of an example: indented JSON for JSON content,
+// the string itself for string examples of other content.
+func exampleText(example json.RawMessage, isJson bool) string {
+	if isJson {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, example, "", "  "); err == nil {
+			return buf.String()
+		}
+	}
+	var s string
+	if err := json.Unmarshal(example, &s); err == nil {
+		return s
+	}
+	return string(example)
+}
+
+// schemaDocument adds the component schemas to schema as $defs,
+// rewriting references to them.
+func (spec *OpenAPI) schemaDocument(schema json.RawMessage) string {
+	doc := strings.TrimSpace(string(schema))
+	if defs := bytes.TrimSpace(spec.Components.Schemas); len(defs) > 0 && strings.HasPrefix(doc, "{") {
+		rest := strings.TrimSpace(doc[1:])
+		if rest != "}" {
+			rest = "," + rest
+		}
+		doc = `{"$defs":` + string(defs) + rest
+	}
+	return strings.Replace(doc, `"#/components/schemas/`, `"#/$defs/`, -1)
+}
+
+// Import replaces the mocks of the previous document with the operations of data.
+func (imp *OpenAPIImports) Import(data []byte) ([]*ImportedOperation, error) {
+	spec, err := parseOpenAPI(data)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := spec.definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(defs))
+	mocks := make([]*mock, 0, len(defs))
+	ops := make([]*ImportedOperation, 0, len(defs))
+	for _, def := range defs {
+		if ids[def.Id] {
+			return nil, fmt.Errorf("duplicate operation id %s", def.Id)
+		}
+		ids[def.Id] = true
+		m, err := def.compile("")
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", def.Method, def.Path, err)
+		}
+		// like mocks of files imports aren't persisted, -openapi imports again on start
+		m.session.Transient = true
+		if m.route != nil {
+			m.route.Transient = true
+		}
+		mocks = append(mocks, m)
+		ops = append(ops, &ImportedOperation{
+			Id:          def.Id,
+			Method:      def.Method,
+			Path:        def.Path,
+			Status:      def.Status,
+			ContentType: def.ContentType,
+			Schema:      def.Schema,
+		})
+	}
+
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	if err := imp.checkIds(mocks); err != nil {
+		return nil, err
+	}
+	if err := swapMocks(imp.mocks, mocks); err != nil {
+		return nil, err
+	}
+	imp.mocks = mocks
+	return ops, nil
+}
+
+// checkIds fails if a mock takes the id of a session or a route which isn't
+// one of the previous import, e.g. a mock of -mocks files.
+func (imp *OpenAPIImports) checkIds(mocks []*mock) error {
+	prev := make(map[string]bool, len(imp.mocks))
+	for _, m := range imp.mocks {
+		prev[m.session.Uuid] = true
+	}
+	for _, m := range mocks {
+		id := m.session.Uuid
+		if prev[id] {
+			continue
+		}
+		_, sessionFound := LocalStore.GetSession(id)
+		_, routeFound := LocalStore.GetRoute(id)
+		if sessionFound || routeFound {
+			return fmt.Errorf("mock id %s is already used", id)
+		}
+	}
+	return nil
+}
+
+// openapiImport serves POST /openapi: the body is an OpenAPI 3 document in JSON or YAML.
+func openapiImport(w http.ResponseWriter, r *http.Request, _ *generator.RandomDataCollection) int {
+	if r.Method != http.MethodPost {
+		return respMethodNotAllowed(w, r)
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	defer r.Body.Close()
+
+	ops, err := LocalImports.Import(data)
+	if err != nil {
+		return respError(w, http.StatusBadRequest, errCodeBadRequest, "openapi import: "+err.Error(), nil)
+	}
+	log.Printf("%d operations imported", len(ops))
+	return respJson(w, http.StatusCreated, ops)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const openapiExportPath = "/openapi.json"
+
+// openapiVersion is the version of exported documents.
+const openapiVersion = "3.0.3"
+
+var stringSchema = json.RawMessage(`{"type":"string"}`)
+
+// anyMethods are the operations exported for routes matching any method.
+var anyMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// exportOpenAPI describes mock routes, response schemas are inferred from
+// outputSamples renders of JSON responses.
+func exportOpenAPI(collection *generator.RandomDataCollection) *OpenAPI {
+	spec := &OpenAPI{
+		OpenAPI: openapiVersion,
+		Info:    &openapiInfo{Title: "mock-ass", Version: "1.0.0"},
+		Paths:   make(map[string]map[string]json.RawMessage),
+	}
+	schemas := make(map[string]json.RawMessage)
+
+	routes := LocalStore.Routes()
+	sort.Sort(routesByPath(routes))
+	for _, route := range routes {
+		session, found := LocalStore.GetSession(route.Session)
+		if !found {
+			continue
+		}
+		path, params := routeOpenAPIPath(route)
+		resp, defs := describeResponse(session, collection)
+		addComponents(schemas, session.Uuid, resp, defs)
+
+		methods := anyMethods
+		if route.Method != "" {
+			methods = []string{strings.ToLower(route.Method)}
+		}
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = make(map[string]json.RawMessage)
+		}
+		status := strconv.Itoa(responseStatusOf(session))
+		for _, method := range methods {
+			op := new(openapiOperation)
+			if raw, ok := spec.Paths[path][method]; ok {
+				// another route of the path, e.g. in another scenario state
+				json.Unmarshal(raw, op)
+			} else {
+				op.OperationId = route.Id
+				if route.Method == "" {
+					op.OperationId += "-" + method
+				}
+				op.Parameters = params
+				op.Responses = make(map[string]*openapiResponse)
+			}
+			if _, ok := op.Responses[status]; !ok {
+				op.Responses[status] = resp
+			}
+			raw, err := json.Marshal(op)
+			if err != nil {
+				log.Printf("openapi export: route %s: %v", route.Id, err)
+				continue
+			}
+			spec.Paths[path][method] = raw
+		}
+	}
+
+	if len(schemas) > 0 {
+		spec.Components.Schemas, _ = json.Marshal(schemas)
+	}
+	return spec
+}
+
+func responseStatusOf(session *Session) int {
+	if session.Status != 0 {
+		return session.Status
+	}
+	return http.StatusOK
+}
+
+// routeOpenAPIPath returns the route path in OpenAPI syntax and its path parameters.
+func routeOpenAPIPath(route *MockRoute) (string, []*openapiParameter) {
+	if route.Match != matchPattern {
+		return route.Path, nil
+	}
+	var params []*openapiParameter
+	segments := splitPath(route.Path)
+	for i, segment := range segments {
+		name, isParam, _ := parseSegment(segment)
+		if !isParam {
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, &openapiParameter{Name: name, In: "path", Required: true, Schema: stringSchema})
+	}
+	return "/" + strings.Join(segments, "/"), params
+}
+
+// describeResponse describes responses of the session; defs are schemas of
+// $defs and definitions of a JSON Schema session to be added to components.
+func describeResponse(session *Session, collection *generator.RandomDataCollection) (*openapiResponse, map[string]json.RawMessage) {
+	resp := &openapiResponse{Description: fmt.Sprintf("session %s", session.Uuid)}
+	if len(session.Headers) > 0 {
+		resp.Headers = make(map[string]*openapiHeader, len(session.Headers))
+		for name := range session.Headers {
+			resp.Headers[name] = &openapiHeader{Schema: stringSchema}
+		}
+	}
+	contentType := session.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	if session.GraphQL {
+		resp.Content = map[string]*openapiMediaType{"application/json": {Schema: json.RawMessage(`{"type":"object"}`)}}
+		return resp, nil
+	}
+	if session.Schema {
+		schema, defs, err := exportSchema(session.Template)
+		if err != nil {
+			log.Printf("openapi export: session %s: %v", session.Uuid, err)
+		}
+		resp.Content = map[string]*openapiMediaType{contentType: {Schema: schema}}
+		return resp, defs
+	}
+
+	samples := make([]string, 0, outputSamples)
+	for i := 0; i < outputSamples; i++ {
+		result, err := renderSession(session, getHash(), trialRequest(), nil, collection)
+		if err != nil {
+			log.Printf("openapi export: session %s: %v", session.Uuid, err)
+			return resp, nil
+		}
+		samples = append(samples, result.Body)
+	}
+	if strings.Join(samples, "") == "" {
+		return resp, nil
+	}
+
+	media := &openapiMediaType{Schema: stringSchema}
+	if outputKind(contentType) == outputJson {
+		media.Schema = nil
+		schema, err := generator.InferSchema(samples)
+		if err == nil {
+			media.Schema, err = json.Marshal(schema)
+		}
+		if err != nil {
+			log.Printf("openapi export: session %s: %v", session.Uuid, err)
+		}
+	}
+	resp.Content = map[string]*openapiMediaType{contentType: media}
+	return resp, nil
+}
+
+// exportSchema moves $defs and definitions of a JSON Schema to components,
+// the schema is kept as written otherwise.
+func exportSchema(template string) (json.RawMessage, map[string]json.RawMessage, error) {
+	var schema map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(template), &schema); err != nil {
+		return nil, nil, err
+	}
+	defs := make(map[string]json.RawMessage)
+	for _, key := range []string{"definitions", "$defs"} {
+		var keyDefs map[string]json.RawMessage
+		if err := json.Unmarshal(schema[key], &keyDefs); err == nil {
+			for name, def := range keyDefs {
+				defs[name] = componentRefs(def)
+			}
+		}
+		delete(schema, key)
+	}
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return componentRefs(raw), defs, nil
+}
+
+// addComponents adds defs of the session to schemas. Definitions of the same name
+// are shared if they're equal; otherwise the later one is renamed to
+// {session}_{name} along with references to it from resp and defs.
+func addComponents(schemas map[string]json.RawMessage, sessionUuid string, resp *openapiResponse, defs map[string]json.RawMessage) {
+	var renames []string
+	names := make(map[string]string, len(defs))
+	for name, def := range defs {
+		names[name] = name
+		if other, ok := schemas[name]; ok && !bytes.Equal(other, def) {
+			names[name] = sessionUuid + "_" + name
+			for _, suffix := range []string{`"`, `/`} {
+				renames = append(renames,
+					`"#/components/schemas/`+name+suffix, `"#/components/schemas/`+names[name]+suffix)
+			}
+		}
+	}
+	rename := func(schema json.RawMessage) json.RawMessage { return schema }
+	if len(renames) > 0 {
+		replacer := strings.NewReplacer(renames...)
+		rename = func(schema json.RawMessage) json.RawMessage {
+			return json.RawMessage(replacer.Replace(string(schema)))
+		}
+		for _, media := range resp.Content {
+			media.Schema = rename(media.Schema)
+		}
+	}
+	for name, def := range defs {
+		if _, ok := schemas[names[name]]; !ok {
+			schemas[names[name]] = rename(def)
+		}
+	}
+}
+
+var componentRefsReplacer = strings.NewReplacer(
+	`"#/$defs/`, `"#/components/schemas/`,
+	`"#/definitions/`, `"#/components/schemas/`,
+)
+
+func componentRefs(schema json.RawMessage) json.RawMessage {
+	return json.RawMessage(componentRefsReplacer.Replace(string(schema)))
+}
+
+// openapiExport serves GET /openapi.json describing mock routes.
+func openapiExport(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	if r.Method != http.MethodGet {
+		return respMethodNotAllowed(w, r)
+	}
+	return respJson(w, http.StatusOK, exportOpenAPI(collection))
+}
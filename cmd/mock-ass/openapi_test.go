@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testOpenAPI = `
+openapi: 3.0.1
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users/{id}:
+    get:
+      operationId: getUser
+      responses:
+        "200":
+          description: user
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+        "404":
+          description: not found
+    delete:
+      responses:
+        "204":
+          description: deleted
+  /users:
+    post:
+      responses:
+        201:
+          description: created
+          headers:
+            Location:
+              example: /v1/users/42
+          content:
+            application/json:
+              example: {"id": 42, "name": "{{ not a template }}"}
+  /health:
+    get:
+      responses:
+        default:
+          $ref: '#/components/responses/Health'
+components:
+  schemas:
+    User:
+      type: object
+      required: [id, email]
+      properties:
+        id: {type: integer, minimum: 1}
+        email: {type: string, format: email}
+  responses:
+    Health:
+      description: health
+      content:
+        text/plain:
+          example: ok
+`
+
+func TestImportOpenAPI(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalImports = &OpenAPIImports{}
+	handler := newAppHandler(initTestCollection(t), Route{path: openapiPath, hand: openapiImport})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, openapiPath, strings.NewReader(testOpenAPI)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: status expected %d; actual %d", http.StatusCreated, w.Code)
+	}
+	var ops []*ImportedOperation
+	if err := json.Unmarshal(w.Body.Bytes(), &ops); err != nil {
+		t.Fatalf("import response %q: %v", w.Body.String(), err)
+	}
+	if len(ops) != 4 {
+		t.Errorf("operations expected 4; actual %d", len(ops))
+	}
+
+	cases := []struct {
+		method, path string
+		statusCode   int
+		contentType  string
+		body         string
+	}{
+		{http.MethodGet, "/v1/users/1", http.StatusOK, "application/json", ""},
+		{http.MethodDelete, "/v1/users/1", http.StatusNoContent, "text/plain", ""},
+		{http.MethodPost, "/v1/users", http.StatusCreated, "application/json", "{\n  \"id\": 42,\n  \"name\": \"{{ not a template }}\"\n}"},
+		{http.MethodGet, "/v1/health", http.StatusOK, "text/plain", "ok"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.statusCode {
+			t.Errorf("%s %s: status expected %d; actual %d", c.method, c.path, c.statusCode, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, c.contentType) {
+			t.Errorf("%s %s: content type expected %q; actual %q", c.method, c.path, c.contentType, contentType)
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s %s: body expected %q; actual %q", c.method, c.path, c.body, w.Body.String())
+		}
+		if c.method == http.MethodPost {
+			if location := w.Header().Get("Location"); location != "/v1/users/42" {
+				t.Errorf("%s %s: Location expected /v1/users/42; actual %q", c.method, c.path, location)
+			}
+		}
+		if c.method == http.MethodGet && c.path == "/v1/users/1" {
+			var user struct {
+				Id    int
+				Email string
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || user.Id < 1 || !strings.Contains(user.Email, "@") {
+				t.Errorf("%s %s: user expected; actual %q", c.method, c.path, w.Body.String())
+			}
+		}
+	}
+
+	// the next import replaces the previous one
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, openapiPath, strings.NewReader(`{"openapi": "3.0.0", "paths": {}}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: status expected %d; actual %d", http.StatusCreated, w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/health", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /v1/health after the next import: status expected %d; actual %d", http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, openapiPath, strings.NewReader(`swagger: "2.0"`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("swagger 2.0: status expected %d; actual %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestImportOpenAPIIdTaken(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalImports = &OpenAPIImports{}
+	LocalStore.SetSession(&Session{Uuid: "getUser", Template: "mock"}, 0)
+
+	_, err := LocalImports.Import([]byte(testOpenAPI))
+	if err == nil || !strings.Contains(err.Error(), "mock id getUser is already used") {
+		t.Fatalf("Import expected to fail on a taken id; actual %v", err)
+	}
+	if session, _ := LocalStore.GetSession("getUser"); session.Template != "mock" {
+		t.Errorf("session getUser expected untouched; actual template %q", session.Template)
+	}
+	if routes := LocalStore.Routes(); len(routes) != 0 {
+		t.Errorf("no routes expected after a failed import; actual %d", len(routes))
+	}
+
+	// the ids of the previous import are replaced
+	LocalStore.DeleteSession("getUser")
+	if _, err := LocalImports.Import([]byte(testOpenAPI)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LocalImports.Import([]byte(testOpenAPI)); err != nil {
+		t.Errorf("repeated import: %v", err)
+	}
+}
+
+func TestImportOpenAPIRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { LocalStore = newMemoryStore() }()
+
+	for i := 0; i < 2; i++ {
+		store, err := newFileStore(dir)
+		if err != nil {
+			t.Fatalf("start %d: newFileStore error: %v", i, err)
+		}
+		LocalStore = store
+		LocalImports = &OpenAPIImports{}
+		if _, err := LocalImports.Import([]byte(testOpenAPI)); err != nil {
+			t.Errorf("start %d: import: %v", i, err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportOpenAPI(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalImports = &OpenAPIImports{}
+	collection := initTestCollection(t)
+	handler := newAppHandler(collection,
+		Route{path: routesPath, hand: routesAdmin, prefix: true},
+		Route{path: openapiExportPath, hand: openapiExport},
+	)
+	if _, err := LocalImports.Import([]byte(testOpenAPI)); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routes/?method=GET&path=/orders/{id}",
+		strings.NewReader(`{"id": {{ Number(1, 10) }}, "customer": "{{ FullName() }}", "paid": {{ BooleanString() }}}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create route: status expected %d; actual %d", http.StatusCreated, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, openapiExportPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status expected %d; actual %d", http.StatusOK, w.Code)
+	}
+	var spec struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			OperationId string
+			Parameters  []struct{ Name, In string }
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema json.RawMessage
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("export response %q: %v", w.Body.String(), err)
+	}
+
+	getUser := spec.Paths["/v1/users/{id}"]["get"]
+	if getUser.OperationId != "getUser" {
+		t.Errorf("GET /v1/users/{id}: operationId expected getUser; actual %q", getUser.OperationId)
+	}
+	if schema := string(getUser.Responses["200"].Content["application/json"].Schema); schema != `{"$ref":"#/components/schemas/User"}` {
+		t.Errorf("GET /v1/users/{id}: schema expected a reference to User; actual %s", schema)
+	}
+	if _, ok := spec.Components.Schemas["User"]; !ok {
+		t.Error("components: User schema expected")
+	}
+	if _, ok := spec.Paths["/v1/users/{id}"]["delete"].Responses["204"]; !ok {
+		t.Error("DELETE /v1/users/{id}: 204 response expected")
+	}
+
+	getOrder := spec.Paths["/orders/{id}"]["get"]
+	if len(getOrder.Parameters) != 1 || getOrder.Parameters[0].Name != "id" || getOrder.Parameters[0].In != "path" {
+		t.Errorf("GET /orders/{id}: path parameter id expected; actual %+v", getOrder.Parameters)
+	}
+	expected := `{"type":"object","properties":{"id":{"type":"integer"},"customer":{"type":"string"},"paid":{"type":"boolean"}},"required":["id","customer","paid"]}`
+	if schema := string(getOrder.Responses["200"].Content["application/json"].Schema); schema != expected {
+		t.Errorf("GET /orders/{id}: schema expected\n%s\nactual\n%s", expected, schema)
+	}
+}
+
+func TestExportOpenAPIComponents(t *testing.T) {
+	LocalStore = newMemoryStore()
+	for _, s := range []struct{ id, item string }{
+		{"a", `{"type": "string"}`},
+		{"b", `{"type": "integer"}`},
+		{"c", `{"type": "string"}`},
+	} {
+		LocalStore.SetSession(&Session{
+			Uuid:        s.id,
+			Schema:      true,
+			ContentType: "application/json",
+			Template:    `{"type": "array", "items": {"$ref": "#/$defs/Item"}, "$defs": {"Item": ` + s.item + `}}`,
+		}, 0)
+		LocalStore.SetRoute(&MockRoute{Id: s.id, Method: http.MethodGet, Path: "/" + s.id, Match: matchExact, Session: s.id})
+	}
+
+	spec := exportOpenAPI(initTestCollection(t))
+	var schemas map[string]json.RawMessage
+	if err := json.Unmarshal(spec.Components.Schemas, &schemas); err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 2 || string(schemas["Item"]) != `{"type":"string"}` || string(schemas["b_Item"]) != `{"type":"integer"}` {
+		t.Errorf("components expected Item and b_Item; actual %s", spec.Components.Schemas)
+	}
+	for id, ref := range map[string]string{"a": "Item", "b": "b_Item", "c": "Item"} {
+		var op struct {
+			Responses map[string]struct {
+				Content map[string]struct{ Schema json.RawMessage }
+			}
+		}
+		json.Unmarshal(spec.Paths["/"+id]["get"], &op)
+		schema := string(op.Responses["200"].Content["application/json"].Schema)
+		if !strings.Contains(schema, `"#/components/schemas/`+ref+`"`) {
+			t.Errorf("GET /%s: schema expected to refer to %s; actual %s", id, ref, schema)
+		}
+	}
+}
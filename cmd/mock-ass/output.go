@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Output kinds checked by content type.
+const (
+	outputJson = "json"
+	outputXml  = "xml"
+	outputCsv  = "csv"
+	outputYaml = "yaml"
+)
+
+// Output formats applied before rendered responses are cached.
+const (
+	formatPretty = "pretty"
+	formatMinify = "minify"
+)
+
+const (
+	formKeyFormat      = "format"
+	formKeyOutputCheck = "output_check"
+)
+
+// outputSamples is the number of renders checked when a template is created.
+const outputSamples = 5
+
+// OutputError is invalid rendered output, Line and Column are 1-based if known.
+type OutputError struct {
+	Kind    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *OutputError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("invalid %s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("invalid %s at line %d, column %d: %s", e.Kind, e.Line, e.Column, e.Message)
+}
+
+// outputKind returns the kind of output checked for the content type, empty if it isn't checked.
+func outputKind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return outputJson
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return outputXml
+	case mediaType == "text/csv":
+		return outputCsv
+	case strings.HasSuffix(mediaType, "/yaml") || strings.HasSuffix(mediaType, "/x-yaml") || strings.HasSuffix(mediaType, "+yaml"):
+		return outputYaml
+	}
+	return ""
+}
+
+func parseFormat(s string) (string, error) {
+	switch s {
+	case "", formatPretty, formatMinify:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid format %q, expected %s or %s", s, formatPretty, formatMinify)
+}
+
+// offsetPosition returns the 1-based line and column of the byte at offset.
+func offsetPosition(s string, offset int64) (line, column int) {
+	if offset > int64(len(s)) {
+		offset = int64(len(s))
+	}
+	before := s[:offset]
+	return strings.Count(before, "\n") + 1, len(before) - strings.LastIndex(before, "\n")
+}
+
+// checkOutput parses body as the output kind.
+func checkOutput(kind, body string) error {
+	var err error
+	switch kind {
+	case outputJson:
+		var v interface{}
+		if err = json.Unmarshal([]byte(body), &v); err != nil {
+			e := &OutputError{Kind: kind, Message: err.Error()}
+			if serr, ok := err.(*json.SyntaxError); ok && serr.Offset > 0 {
+				// Offset is just after the offending byte
+				e.Line, e.Column = offsetPosition(body, serr.Offset-1)
+			}
+			return e
+		}
+	case outputXml:
+		dec := xml.NewDecoder(strings.NewReader(body))
+		root := false
+		for {
+			token, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				e := &OutputError{Kind: kind, Message: err.Error()}
+				if serr, ok := err.(*xml.SyntaxError); ok {
+					e.Line, e.Message = serr.Line, serr.Msg
+				}
+				return e
+			}
+			if _, ok := token.(xml.StartElement); ok {
+				root = true
+			}
+		}
+		if !root {
+			return &OutputError{Kind: kind, Message: "no root element"}
+		}
+	case outputCsv:
+		_, err = csv.NewReader(strings.NewReader(body)).ReadAll()
+		if perr, ok := err.(*csv.ParseError); ok {
+			return &OutputError{Kind: kind, Line: perr.Line, Column: perr.Column, Message: perr.Err.Error()}
+		}
+	case outputYaml:
+		var v interface{}
+		err = yaml.Unmarshal([]byte(body), &v)
+	}
+	if err != nil {
+		return &OutputError{Kind: kind, Message: err.Error()}
+	}
+	return nil
+}
+
+// formatOutput pretty-prints or minifies JSON and XML, other kinds are kept as is.
+func formatOutput(kind, body, format string) (string, error) {
+	if format == "" {
+		return body, nil
+	}
+	switch kind {
+	case outputJson:
+		var buf bytes.Buffer
+		var err error
+		if format == formatPretty {
+			err = json.Indent(&buf, []byte(body), "", "  ")
+		} else {
+			err = json.Compact(&buf, []byte(body))
+		}
+		if err != nil {
+			return body, &OutputError{Kind: kind, Message: err.Error()}
+		}
+		return buf.String(), nil
+	case outputXml:
+		return formatXml(body, format == formatPretty)
+	}
+	return body, nil
+}
+
+// formatXml re-encodes raw tokens, so namespace prefixes are kept as written.
+func formatXml(body string, pretty bool) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(body))
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+	for {
+		token, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return body, &OutputError{Kind: outputXml, Message: err.Error()}
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		case xml.StartElement:
+			t.Name = rawXmlName(t.Name)
+			for i := range t.Attr {
+				t.Attr[i].Name = rawXmlName(t.Attr[i].Name)
+			}
+			token = t
+		case xml.EndElement:
+			t.Name = rawXmlName(t.Name)
+			token = t
+		}
+		if err := enc.EncodeToken(token); err != nil {
+			return body, &OutputError{Kind: outputXml, Message: err.Error()}
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return body, err
+	}
+	return buf.String(), nil
+}
+
+func rawXmlName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// checkSessionOutput renders the session outputSamples times with different hashes
+// and checks the outputs parse as the session content type, if the session asks for it. Empty templates
+// are responses without a body and aren't checked.
+func checkSessionOutput(session *Session, render func(hash string) (string, error)) (string, error) {
+	kind := outputKind(session.ContentType)
+	if kind == "" || !session.OutputCheck || session.Template == "" {
+		return "", nil
+	}
+	for i := 0; i < outputSamples; i++ {
+		// fixed hashes of a deterministic render, so a template passes or fails every time
+		out, err := render(eventHash("output-check", i+1))
+		if err != nil {
+			return "", err
+		}
+		if err := checkOutput(kind, out); err != nil {
+			return out, err
+		}
+	}
+	return "", nil
+}
+
+func parseOutputCheck(raw string) (bool, error) {
+	check, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", formKeyOutputCheck, raw)
+	}
+	return check, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutput(t *testing.T) {
+	cases := []struct {
+		contentType, body string
+		valid             bool
+		line              int
+	}{
+		{"application/json; charset=utf-8", `{"a": [1, 2]}`, true, 0},
+		{"application/json", "{\n  \"a\": 1,\n}", false, 3},
+		{"application/vnd.api+json", `{"a": name}`, false, 1},
+		{"application/xml", `<a><b x="1"/></a>`, true, 0},
+		{"text/xml", "<a>\n<b></a>", false, 2},
+		{"text/csv", "a,b\n1,2\n", true, 0},
+		{"text/csv", "a,b\n1,2,3\n", false, 2},
+		{"application/x-yaml", "a: [1, 2]\n", true, 0},
+		{"application/yaml", "a: [1, 2\n", false, 0},
+	}
+	for _, c := range cases {
+		kind := outputKind(c.contentType)
+		if kind == "" {
+			t.Errorf("%s: expected to be checked", c.contentType)
+			continue
+		}
+		err := checkOutput(kind, c.body)
+		if c.valid != (err == nil) {
+			t.Errorf("%s %q: valid expected %v; actual error %v", c.contentType, c.body, c.valid, err)
+			continue
+		}
+		if oerr, ok := err.(*OutputError); ok && c.line != 0 && oerr.Line != c.line {
+			t.Errorf("%s %q: error line expected %d; actual %d", c.contentType, c.body, c.line, oerr.Line)
+		}
+	}
+	if kind := outputKind("text/plain"); kind != "" {
+		t.Errorf("text/plain expected not to be checked; actual %s", kind)
+	}
+}
+
+func TestFormatOutput(t *testing.T) {
+	cases := []struct {
+		kind, body, format, expected string
+	}{
+		{outputJson, "{\"a\": [1,\n 2]}", formatMinify, `{"a":[1,2]}`},
+		{outputJson, `{"a":[1]}`, formatPretty, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{outputXml, "<s:a xmlns:s=\"urn:s\">\n  <s:b>1</s:b>\n</s:a>", formatMinify, `<s:a xmlns:s="urn:s"><s:b>1</s:b></s:a>`},
+		{outputXml, `<a><b>1</b></a>`, formatPretty, "<a>\n  <b>1</b>\n</a>"},
+		{outputCsv, "a, b\n", formatMinify, "a, b\n"},
+	}
+	for _, c := range cases {
+		out, err := formatOutput(c.kind, c.body, c.format)
+		if err != nil {
+			t.Errorf("%s %q: %v", c.format, c.body, err)
+		}
+		if out != c.expected {
+			t.Errorf("%s %q: expected %q; actual %q", c.format, c.body, c.expected, out)
+		}
+	}
+}
+
+func TestInitOutputCheck(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	broken := `{"name": "{{ FirstName() }}", "ids": [{% for i in Range(3) %}{{ i }},{% endfor %}]}`
+	for _, query := range []string{"?content_type=application/json", "?output_check=true"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init"+query, strings.NewReader(broken)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"output":`) {
+			t.Errorf("%s: trailing comma expected to be rejected with the output; actual %d %s", query, w.Code, w.Body.String())
+		}
+	}
+
+	for _, query := range []string{"", "?content_type=application/json&output_check=false"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init"+query, strings.NewReader(broken)))
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: the template expected to be accepted; actual %d %s", query, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?format=minify", strings.NewReader("{\n  \"a\": {{ Number(1, 2) }}\n}")))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sessionResp.Url, nil))
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil))
+	if body := w2.Body.String(); body != `{"a":1}` {
+		t.Errorf("minified body expected %q; actual %q", `{"a":1}`, body)
+	}
+}
+
+func TestOutputCheckStable(t *testing.T) {
+	collection := initTestCollection(t)
+	// about every tenth render is broken, unless the trial renders are deterministic
+	session := &Session{
+		Template:    `{% if Number(1, 100) > 90 %}broken{% else %}{"a": 1}{% endif %}`,
+		ContentType: "application/json",
+		OutputCheck: true,
+	}
+	first := validateSession(session, collection) == nil
+	for i := 0; i < 20; i++ {
+		if valid := validateSession(session, collection) == nil; valid != first {
+			t.Fatalf("validation %d: valid %v, but %v at first", i, valid, first)
+		}
+	}
+}
+
+func TestLoadMocksOutputCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-mocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"users.yaml": "- id: user\n  path: /users/1\n  content_type: application/json\n  template: '{\"name\": {{ FirstName() }}}'\n",
+	})
+
+	LocalStore = newMemoryStore()
+	_, err = newMockLoader(dir, initTestCollection(t)).Load()
+	if err == nil || !strings.Contains(err.Error(), "mock user: invalid template") {
+		t.Fatalf("Load expected to fail on invalid JSON output; actual %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +21,13 @@ func parseTtlMin(r *http.Request) (time.Duration, error) {
 	if err != nil {
 		return 0, err
 	}
+	// a session expired at once would answer 404 to the next request
+	if ttlParsedInt <= 0 {
+		return 0, fmt.Errorf("%d is not positive", ttlParsedInt)
+	}
+	if ttlParsedInt > int64(math.MaxInt64/time.Minute) {
+		return 0, fmt.Errorf("%d is too large", ttlParsedInt)
+	}
 
 	ttl := time.Duration(ttlParsedInt) * time.Minute
 	return ttl, err
@@ -30,3 +40,126 @@ func parseContentType(r *http.Request) string {
 	return defaultContentType
 
 }
+
+func parseStatus(r *http.Request) (int, error) {
+	statusRaw := r.URL.Query().Get(formKeyStatus)
+	status, err := strconv.Atoi(statusRaw)
+	if err != nil {
+		return 0, err
+	}
+	// 1xx are informational, a handler can't finish a response with them
+	if status < 200 || status > 599 {
+		return 0, fmt.Errorf("invalid status code %d", status)
+	}
+	return status, nil
+}
+
+// parseHeaders parses `header=Name: value` query parameters; values may be templates.
+func parseHeaders(r *http.Request) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, headerRaw := range r.URL.Query()[formKeyHeader] {
+		i := strings.Index(headerRaw, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected 'Name: value'", headerRaw)
+		}
+		name := http.CanonicalHeaderKey(strings.TrimSpace(headerRaw[:i]))
+		headers[name] = strings.TrimSpace(headerRaw[i+1:])
+	}
+	return headers, nil
+}
+
+// parseSessionOptions applies response options from the query to session.
+// Options missing in the query keep their current values.
+func parseSessionOptions(r *http.Request, session *Session) error {
+	q := r.URL.Query()
+	if q.Get(formKeyContentType) != "" {
+		session.ContentType = parseContentType(r)
+		session.OutputCheck = true
+	}
+	if _, ok := q[formKeyStatus]; ok {
+		status, err := parseStatus(r)
+		if err != nil {
+			return err
+		}
+		session.Status = status
+	}
+	if _, ok := q[formKeyHeader]; ok {
+		headers, err := parseHeaders(r)
+		if err != nil {
+			return err
+		}
+		session.Headers = headers
+	}
+	if _, ok := q[formKeyDelay]; ok {
+		session.Delay = nil
+		if delayRaw := q.Get(formKeyDelay); delayRaw != "" {
+			delay, err := parseDelay(delayRaw)
+			if err != nil {
+				return err
+			}
+			session.Delay = delay
+		}
+	}
+	for key, value := range map[string]*string{
+		formKeyScenario:      &session.Scenario,
+		formKeyRequiredState: &session.RequiredState,
+		formKeyNewState:      &session.NewState,
+	} {
+		if _, ok := q[key]; ok {
+			*value = q.Get(key)
+		}
+	}
+	if _, ok := q[formKeyFormat]; ok {
+		format, err := parseFormat(q.Get(formKeyFormat))
+		if err != nil {
+			return err
+		}
+		session.Format = format
+	}
+	if q.Get(formKeyOutputCheck) != "" {
+		check, err := parseOutputCheck(q.Get(formKeyOutputCheck))
+		if err != nil {
+			return err
+		}
+		session.OutputCheck = check
+	}
+	if q.Get(formKeySchema) != "" {
+		schema, err := parseSchemaFlag(q.Get(formKeySchema))
+		if err != nil {
+			return err
+		}
+		session.Schema = schema
+	}
+	if q.Get(formKeyGraphQL) != "" {
+		graphql, err := parseGraphQLFlag(q.Get(formKeyGraphQL))
+		if err != nil {
+			return err
+		}
+		session.GraphQL = graphql
+	}
+	if q.Get(formKeyDeterministic) != "" {
+		deterministic, err := parseDeterministicFlag(q.Get(formKeyDeterministic))
+		if err != nil {
+			return err
+		}
+		session.Deterministic = deterministic
+	}
+	stream, err := parseEventStream(q, session.Stream)
+	if err != nil {
+		return err
+	}
+	session.Stream = stream
+	ws, err := parseWebSocket(q, session.WebSocket)
+	if err != nil {
+		return err
+	}
+	session.WebSocket = ws
+	fault, found, err := parseFaultPolicy(r)
+	if err != nil {
+		return err
+	}
+	if found {
+		session.Fault = fault
+	}
+	return nil
+}
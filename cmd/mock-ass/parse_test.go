@@ -39,6 +39,18 @@ func TestParseTtlMinDefault(t *testing.T) {
 	}
 }
 
+func TestParseTtlMinRange(t *testing.T) {
+	for _, query := range []string{"/?session_ttl_min=0", "/?session_ttl_min=-5", "/?session_ttl_min=9223372036854775807"} {
+		req, err := http.NewRequest(http.MethodGet, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl, err := parseTtlMin(req); err == nil {
+			t.Errorf("%s: expected err, but ttl is %v", query, ttl)
+		}
+	}
+}
+
 func TestParseTtlMinError(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, "/?session_ttl_min=invalid_ttl", nil)
 	if err != nil {
@@ -56,3 +68,46 @@ func TestParseTtlMinError(t *testing.T) {
 		t.Errorf("ttl expected %v; actual %v", 0, ttl)
 	}
 }
+
+func TestParseSessionOptions(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/?status=201&header=location:%20/orders/{{%20hash%20}}&header=X-Total-Count:{{%20Number(100)%20}}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := &Session{ContentType: defaultContentType}
+	if err := parseSessionOptions(req, session); err != nil {
+		t.Fatalf("expected err is nil, but %+v", err)
+	}
+
+	if session.Status != http.StatusCreated {
+		t.Errorf("status expected %d; actual %d", http.StatusCreated, session.Status)
+	}
+	if session.ContentType != defaultContentType {
+		t.Errorf("content type expected %s; actual %s", defaultContentType, session.ContentType)
+	}
+	expected := map[string]string{
+		"Location":      "/orders/{{ hash }}",
+		"X-Total-Count": "{{ Number(100) }}",
+	}
+	if len(session.Headers) != len(expected) {
+		t.Errorf("headers expected %v; actual %v", expected, session.Headers)
+	}
+	for name, value := range expected {
+		if session.Headers[name] != value {
+			t.Errorf("header %s expected %q; actual %q", name, value, session.Headers[name])
+		}
+	}
+}
+
+func TestParseSessionOptionsError(t *testing.T) {
+	for _, query := range []string{"/?status=99", "/?status=101", "/?status=600", "/?status=ok", "/?header=no-colon"} {
+		req, err := http.NewRequest(http.MethodPost, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parseSessionOptions(req, &Session{}); err == nil {
+			t.Errorf("%s: expected err, but is nil", query)
+		}
+	}
+}
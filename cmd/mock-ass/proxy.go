@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+// hopHeaders are not forwarded in either direction.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// unrecordedHeaders are response headers set by mock-ass itself.
+var unrecordedHeaders = []string{
+	"Content-Length",
+	"Content-Type",
+	"Content-Encoding",
+	"Date",
+}
+
+var mockIdRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Recorder forwards requests without a mock to the upstream and records the
+// responses as mocks, so the same requests are replayed from then on.
+type Recorder struct {
+	upstream *url.URL
+	// dir keeps definition files of recorded mocks, nothing is written if empty
+	dir string
+	// infer replaces recognised values with generator functions
+	infer  bool
+	client *http.Client
+	mu     sync.Mutex
+}
+
+func newRecorder(upstream, dir string, infer bool) (*Recorder, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q, expected an absolute URL", upstream)
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{
+		// redirects are passed to the client and recorded as they are
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Recorder{upstream: u, dir: dir, infer: infer, client: client}, nil
+}
+
+var LocalRecorder *Recorder
+
+// recordedMockId is unique for the method and the path, e.g. get-api-v1-users.
+func recordedMockId(method, path string) string {
+	return strings.Trim(mockIdRegexp.ReplaceAllString(strings.ToLower(method+" "+path), "-"), "-")
+}
+
+// serve forwards r to the upstream, passes the response to w and records it.
+func (rec *Recorder) serve(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	r.Body.Close()
+
+	target := *rec.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	req = req.WithContext(r.Context())
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	// let the transport negotiate compression, so the body is recorded decoded
+	req.Header.Del("Accept-Encoding")
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+
+	resp, err := rec.client.Do(req)
+	if err != nil {
+		return respError(w, http.StatusBadGateway, errCodeBadGateway,
+			fmt.Sprintf("proxy %s: %v", target.String(), err), map[string]string{"upstream": target.String()})
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return respError(w, http.StatusBadGateway, errCodeBadGateway,
+			fmt.Sprintf("proxy %s: %v", target.String(), err), map[string]string{"upstream": target.String()})
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	for _, name := range append(hopHeaders, "Content-Length", "Content-Encoding") {
+		w.Header().Del(name)
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		// upstream failures are passed through, not replayed forever
+		log.Printf("not recorded %s %s: upstream status %d", r.Method, r.URL.Path, resp.StatusCode)
+	} else if err := rec.record(r, resp, string(respBody), collection); err != nil {
+		log.Printf("record %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	return resp.StatusCode
+}
+
+// record installs the response as a mock and writes its definition file.
+func (rec *Recorder) record(r *http.Request, resp *http.Response, body string, collection *generator.RandomDataCollection) error {
+	def := &MockDefinition{
+		Id:          recordedMockId(r.Method, r.URL.Path),
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Match:       matchExact,
+		ContentType: resp.Header.Get("Content-Type"),
+		Status:      resp.StatusCode,
+		Template:    generator.Literal(body),
+	}
+	mediaType, _, _ := mime.ParseMediaType(def.ContentType)
+	if rec.infer && strings.HasSuffix(mediaType, "json") {
+		def.Template = generator.InferTemplate(body, collection)
+	}
+	for name, values := range resp.Header {
+		if containsString(hopHeaders, name) || containsString(unrecordedHeaders, name) {
+			continue
+		}
+		if def.Headers == nil {
+			def.Headers = make(map[string]string)
+		}
+		// a value per line, so Set-Cookie and the like are sent separately
+		def.Headers[name] = generator.Literal(strings.Join(values, "\n"))
+	}
+
+	m, err := def.compile(rec.dir)
+	if err != nil {
+		return err
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if err := swapMocks(nil, []*mock{m}); err != nil {
+		return err
+	}
+	log.Printf("recorded mock %s", def.Id)
+	if rec.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(rec.dir, def.Id+".json"), append(data, '\n'), 0644)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	upstreamHits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "{{ 42 }}")
+		w.Header().Add("Set-Cookie", "a=1; Path=/")
+		w.Header().Add("Set-Cookie", "b=2, c; Path=/")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name": "Grace Smith", "path": "` + r.URL.Path + `"}`))
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "mock-ass-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	LocalStore = newMemoryStore()
+	LocalRecorder, err = newRecorder(upstream.URL, dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { LocalRecorder = nil }()
+	handler := newAppHandler(initTestCollection(t))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{}`)))
+		if w.Code != http.StatusCreated {
+			t.Errorf("request %d: status expected %d; actual %d", i, http.StatusCreated, w.Code)
+		}
+		if w.Header().Get("X-Request-Id") != "{{ 42 }}" {
+			t.Errorf("request %d: header X-Request-Id expected as is; actual %q", i, w.Header().Get("X-Request-Id"))
+		}
+		if cookies := w.Header()["Set-Cookie"]; len(cookies) != 2 || cookies[0] != "a=1; Path=/" || cookies[1] != "b=2, c; Path=/" {
+			t.Errorf("request %d: Set-Cookie headers expected separately; actual %q", i, cookies)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("request %d: body %q: %v", i, w.Body.String(), err)
+		}
+		if body["path"] != "/api/users" || len(strings.Split(body["name"], " ")) != 2 {
+			t.Errorf("request %d: unexpected body %v", i, body)
+		}
+	}
+	if upstreamHits != 1 {
+		t.Errorf("upstream expected to be hit once, then replayed; actual %d hits", upstreamHits)
+	}
+
+	def, err := readMockDefinitions(filepath.Join(dir, "post-api-users.json"))
+	if err != nil {
+		t.Fatalf("recorded definition: %v", err)
+	}
+	if !strings.Contains(def[0].Template, "{{ FullName() }}") {
+		t.Errorf("recorded template expected to be inferred; actual %s", def[0].Template)
+	}
+	LocalStore = newMemoryStore()
+	if _, err := newMockLoader(dir, initTestCollection(t)).Load(); err != nil {
+		t.Errorf("recorded definitions expected to load: %v", err)
+	}
+}
+
+func TestRecorderRedirectAndFailure(t *testing.T) {
+	upstreamHits := map[string]int{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/new":
+			w.Write([]byte("new"))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "mock-ass-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	LocalStore = newMemoryStore()
+	LocalRecorder, err = newRecorder(upstream.URL, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { LocalRecorder = nil }()
+	handler := newAppHandler(initTestCollection(t))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/old", nil))
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "/new" {
+			t.Errorf("request %d: redirect to /new expected; actual %d %q", i, w.Code, w.Header().Get("Location"))
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("request %d: status expected %d; actual %d", i, http.StatusServiceUnavailable, w.Code)
+		}
+	}
+	if upstreamHits["/old"] != 1 || upstreamHits["/new"] != 0 {
+		t.Errorf("redirect expected to be recorded, not followed; actual hits %v", upstreamHits)
+	}
+	if upstreamHits["/fail"] != 2 {
+		t.Errorf("failures expected not to be recorded; actual %d hits", upstreamHits["/fail"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "get-fail.json")); !os.IsNotExist(err) {
+		t.Errorf("definition of a failure expected not to be written; actual %v", err)
+	}
+}
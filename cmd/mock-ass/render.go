@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+// Output formats of the render command.
+const (
+	renderFormatFiles  = ""
+	renderFormatJson   = "json"
+	renderFormatNdjson = "ndjson"
+)
+
+// renderOptions are the flags of `mock-ass render`.
+type renderOptions struct {
+	template string
+	schema   bool
+	seed     string
+	count    int
+	out      string
+	format   string
+	data     string
+}
+
+func parseRenderFlags(args []string, stderr io.Writer) (*renderOptions, error) {
+	opts := new(renderOptions)
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.template, "template", "", "template file to render, - for stdin")
+	flags.BoolVar(&opts.schema, "schema", false, "the template is a JSON Schema")
+	flags.StringVar(&opts.seed, "seed", "", "seed of render hashes, render n has the hash {seed}-{n} (a new seed if empty)")
+	flags.IntVar(&opts.count, "count", 1, "number of renders")
+	flags.StringVar(&opts.out, "out", "", "directory of rendered files, or the file of -format output (stdout if empty)")
+	flags.StringVar(&opts.format, "format", renderFormatFiles, "json to write one JSON array, ndjson to write a JSON document per line")
+	flags.StringVar(&opts.data, "data", dataPath, "data collection directory")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.template == "" {
+		return nil, fmt.Errorf("-template is required")
+	}
+	if opts.count < 1 {
+		return nil, fmt.Errorf("invalid -count %d", opts.count)
+	}
+	switch opts.format {
+	case renderFormatFiles, renderFormatJson, renderFormatNdjson:
+	default:
+		return nil, fmt.Errorf("invalid -format %q", opts.format)
+	}
+	if opts.seed == "" {
+		opts.seed = getHash()
+	}
+	return opts, nil
+}
+
+// runRender renders a template offline, e.g. to produce fixtures in build scripts:
+//
+//	mock-ass render -template t.json.tpl -seed abc -count 100 -out fixtures/
+//
+// Renders get hashes derived from the seed like events of a stream, so the same
+// seed gives the same fixtures for *Chain functions.
+func runRender(args []string, stdout, stderr io.Writer) error {
+	opts, err := parseRenderFlags(args, stderr)
+	if err != nil {
+		return err
+	}
+	var tpl []byte
+	if opts.template == "-" {
+		tpl, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		tpl, err = ioutil.ReadFile(opts.template)
+	}
+	if err != nil {
+		return err
+	}
+	collection, err := generator.InitCollectionFromPath(opts.data)
+	if err != nil {
+		return err
+	}
+
+	render := renderTemplateFunc(string(tpl), opts.schema, collection)
+	if opts.format == renderFormatFiles && opts.out != "" {
+		return renderFiles(opts, render)
+	}
+
+	if opts.out == "" {
+		return renderStream(stdout, opts, render)
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.out), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(opts.out)
+	if err != nil {
+		return err
+	}
+	if err := renderStream(f, opts, render); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// renderTemplateFunc returns a function rendering the template (or generating
+// from the schema) with a hash; templates get a GET / request.
+func renderTemplateFunc(tpl string, schema bool, collection *generator.RandomDataCollection) func(hash string) (string, error) {
+	if schema {
+		parsed, err := generator.ParseSchema([]byte(tpl))
+		return func(hash string) (string, error) {
+			if err != nil {
+				return "", err
+			}
+			return generator.GenerateFromSchema(parsed, hash, collection)
+		}
+	}
+	return func(hash string) (string, error) {
+		return generator.RenderDeterministic(tpl, hash, collection, map[string]interface{}{
+			"request": newTemplateRequest(trialRequest(), nil),
+		})
+	}
+}
+
+// renderFiles writes every render to its own file in the -out directory, named
+// after the template: t.json.tpl gives t-001.json, t-002.json, ...
+func renderFiles(opts *renderOptions, render func(hash string) (string, error)) error {
+	if err := os.MkdirAll(opts.out, 0755); err != nil {
+		return err
+	}
+	base := filepath.Base(opts.template)
+	if opts.template == "-" {
+		base = "fixture"
+	}
+	base = strings.TrimSuffix(base, ".tpl")
+	ext := filepath.Ext(base)
+	base = strings.TrimSuffix(base, ext)
+	width := len(fmt.Sprint(opts.count))
+
+	for n := 1; n <= opts.count; n++ {
+		out, err := render(eventHash(opts.seed, n))
+		if err != nil {
+			return fmt.Errorf("render %d: %v", n, err)
+		}
+		name := fmt.Sprintf("%s-%0*d%s", base, width, n, ext)
+		if err := ioutil.WriteFile(filepath.Join(opts.out, name), []byte(out), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderStream writes renders to w: separated by newlines, as one JSON array or as NDJSON.
+func renderStream(w io.Writer, opts *renderOptions, render func(hash string) (string, error)) error {
+	if opts.format == renderFormatJson {
+		io.WriteString(w, "[")
+	}
+	for n := 1; n <= opts.count; n++ {
+		out, err := render(eventHash(opts.seed, n))
+		if err != nil {
+			return fmt.Errorf("render %d: %v", n, err)
+		}
+		switch opts.format {
+		case renderFormatJson, renderFormatNdjson:
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, []byte(out)); err != nil {
+				return fmt.Errorf("render %d: invalid JSON: %v", n, err)
+			}
+			if opts.format == renderFormatJson {
+				if n > 1 {
+					io.WriteString(w, ",")
+				}
+				io.WriteString(w, "\n  ")
+			}
+			out = buf.String()
+		}
+		if opts.format != renderFormatJson {
+			out = strings.TrimSuffix(out, "\n") + "\n"
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return err
+		}
+	}
+	if opts.format == renderFormatJson {
+		io.WriteString(w, "\n]\n")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tpl := filepath.Join(dir, "user.json.tpl")
+	if err := ioutil.WriteFile(tpl, []byte(`{"hash": "{{ hash }}", "name": "{{ FullNameChain(1) }}"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join("..", "..", "data")
+
+	render := func(args ...string) string {
+		var stdout, stderr bytes.Buffer
+		if err := runRender(append([]string{"-data", data, "-template", tpl, "-seed", "abc"}, args...), &stdout, &stderr); err != nil {
+			t.Fatalf("%v: %v %s", args, err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	ndjson := render("-count", "2", "-format", "ndjson")
+	lines := bytes.Split(bytes.TrimSuffix([]byte(ndjson), []byte("\n")), []byte("\n"))
+	if len(lines) != 2 || !bytes.HasPrefix(lines[0], []byte(`{"hash":"abc-1","name":`)) || !bytes.HasPrefix(lines[1], []byte(`{"hash":"abc-2","name":`)) {
+		t.Errorf("2 NDJSON lines with derived hashes expected; actual %q", ndjson)
+	}
+	if again := render("-count", "2", "-format", "ndjson"); again != ndjson {
+		t.Errorf("renders of the same seed differ:\n%s\n%s", ndjson, again)
+	}
+	expected := "[\n  " + string(lines[0]) + ",\n  " + string(lines[1]) + "\n]\n"
+	if array := render("-count", "2", "-format", "json"); array != expected {
+		t.Errorf("JSON array expected %q; actual %q", expected, array)
+	}
+
+	out := filepath.Join(dir, "fixtures")
+	render("-count", "10", "-out", out)
+	files, err := filepath.Glob(filepath.Join(out, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 10 || filepath.Base(files[0]) != "user-01.json" || filepath.Base(files[9]) != "user-10.json" {
+		t.Errorf("user-01.json..user-10.json expected; actual %v", files)
+	}
+
+	var stdout, stderr bytes.Buffer
+	for _, args := range [][]string{{}, {"-template", tpl, "-count", "0"}, {"-template", tpl, "-format", "csv"}} {
+		if err := runRender(args, &stdout, &stderr); err == nil {
+			t.Errorf("%v: error expected", args)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const maxTemplateRequestBody = 10 << 20
+
+// headerKey turns a header name into a template friendly key: X-Total-Count -> x_total_count.
+func headerKey(name string) string {
+	return strings.Replace(strings.ToLower(name), "-", "_", -1)
+}
+
+func firstValues(values map[string][]string, key func(string) string) map[string]string {
+	m := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 0 {
+			m[key(k)] = v[0]
+		}
+	}
+	return m
+}
+
+func sameKey(k string) string {
+	return k
+}
+
+// newTemplateRequest describes r for templates as the `request` variable:
+//
+//	request.method, request.url, request.path, request.host, request.remote_addr
+//	request.params.<name>   path parameters of a mock route
+//	request.query.<name>    first value of a query parameter, request.query_list.<name> for all values
+//	request.headers.<name>  lower-cased header with '_' instead of '-', e.g. request.headers.user_agent
+//	request.cookies.<name>
+//	request.body            raw body, request.json parsed JSON body, request.form.<name> form fields
+//	request.header("X-Name"), request.cookie("name") for names that are not valid identifiers
+//
+// The body is read and put back, so handlers can still consume it.
+func newTemplateRequest(r *http.Request, params map[string]string) map[string]interface{} {
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, _ = ioutil.ReadAll(io.LimitReader(r.Body, maxTemplateRequestBody))
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	cookies := map[string]string{}
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+
+	var jsonBody interface{}
+	form := map[string]string{}
+	if r.PostForm != nil {
+		// the body is already consumed by ParseForm
+		form = firstValues(r.PostForm, sameKey)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&jsonBody); err != nil {
+			jsonBody = nil
+		}
+	case r.PostForm == nil && (mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"):
+		formReq := *r
+		formReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		formReq.Form, formReq.PostForm, formReq.MultipartForm = nil, nil, nil
+		if mediaType == "multipart/form-data" {
+			formReq.ParseMultipartForm(maxTemplateRequestBody)
+		} else {
+			formReq.ParseForm()
+		}
+		form = firstValues(formReq.PostForm, sameKey)
+	}
+
+	return map[string]interface{}{
+		"method":      r.Method,
+		"url":         r.URL.String(),
+		"path":        r.URL.Path,
+		"host":        r.Host,
+		"remote_addr": r.RemoteAddr,
+		"params":      params,
+		"query":       firstValues(r.URL.Query(), sameKey),
+		"query_list":  map[string][]string(r.URL.Query()),
+		"headers":     firstValues(r.Header, headerKey),
+		"cookies":     cookies,
+		"body":        string(body),
+		"json":        jsonBody,
+		"form":        form,
+		"header":      r.Header.Get,
+		"cookie": func(name string) string {
+			return cookies[name]
+		},
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+func initTestCollection(t *testing.T) *generator.RandomDataCollection {
+	collection, err := generator.InitCollectionFromPath(filepath.Join("..", "..", "data"))
+	if err != nil {
+		t.Fatalf("InitCollectionFromPath error: %v", err)
+	}
+	return collection
+}
+
+func TestTemplateRequest(t *testing.T) {
+	collection := initTestCollection(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/orders/42?limit=3", strings.NewReader(`{"item": {"sku": "A-1"}, "qty": 2}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-Id", "req-1")
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+
+	tpl := `{{ request.method }} {{ request.path }} id={{ request.params.id }} limit={{ request.query.limit }} ` +
+		`rid={{ request.headers.x_request_id }}/{{ request.header("X-Request-Id") }} sid={{ request.cookies.sid }} ` +
+		`sku={{ request.json.item.sku }} qty={{ request.json.qty }} items={% for x in Range(request.query.limit|integer) %}{{ x }}{% endfor %} ` +
+		`{{ Json(request.json.item) }}`
+	out, err := generator.RenderWithContext(tpl, "hash", collection, map[string]interface{}{
+		"request": newTemplateRequest(r, map[string]string{"id": "42"}),
+	})
+	if err != nil {
+		t.Fatalf("RenderWithContext error: %v", err)
+	}
+
+	expected := `POST /orders/42 id=42 limit=3 rid=req-1/req-1 sid=s1 sku=A-1 qty=2 items=123 {"sku":"A-1"}`
+	if out != expected {
+		t.Errorf("expected %q; actual %q", expected, out)
+	}
+}
+
+func TestTemplateRequestForm(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("name=Bob&tag=a&tag=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	request := newTemplateRequest(r, nil)
+	if form := request["form"].(map[string]string); form["name"] != "Bob" || form["tag"] != "a" {
+		t.Errorf("form parsed as %v", form)
+	}
+	if r.FormValue("name") != "Bob" {
+		t.Error("request body must stay readable for handlers")
+	}
+}
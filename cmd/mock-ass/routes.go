@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pmylund/go-cache"
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const routesPath string = "/routes/"
+
+// Route path matching modes.
+const (
+	matchExact   = "exact"
+	matchPrefix  = "prefix"
+	matchPattern = "pattern"
+)
+
+const (
+	formKeyRouteMethod  = "method"
+	formKeyRoutePath    = "path"
+	formKeyRouteMatch   = "match"
+	formKeyRouteSession = "session"
+)
+
+// MockRoute serves the template of a session on a user-defined path.
+//
+// Pattern paths consist of literal segments, `{name}` segments matching any
+// single segment and an optional trailing `{name*}` matching the rest of the path.
+type MockRoute struct {
+	Id      string `json:"id"`
+	Method  string `json:"method,omitempty"` // empty matches any method
+	Path    string `json:"path"`
+	Match   string `json:"match"`
+	Session string `json:"session"`
+	// OwnSession is set when the session was created along with the route
+	// and has to be removed with it.
+	OwnSession bool `json:"own_session,omitempty"`
+	// Fault overrides the fault policy of the session
+	Fault *FaultPolicy `json:"fault,omitempty"`
+	// Transient routes are not persisted, like transient sessions
+	Transient bool `json:"-"`
+}
+
+// faultPolicy returns the route fault policy or the one of its session.
+func (mr *MockRoute) faultPolicy() *FaultPolicy {
+	if mr.Fault != nil {
+		return mr.Fault
+	}
+	if session, found := LocalStore.GetSession(mr.Session); found {
+		return session.Fault
+	}
+	return nil
+}
+
+func (mr *MockRoute) validate() error {
+	if !strings.HasPrefix(mr.Path, "/") {
+		return fmt.Errorf("route path %q must start with '/'", mr.Path)
+	}
+	switch mr.Match {
+	case matchExact, matchPrefix:
+	case matchPattern:
+		for i, segment := range splitPath(mr.Path) {
+			name, isParam, isRest := parseSegment(segment)
+			if isParam && name == "" {
+				return fmt.Errorf("route path %q: empty parameter name", mr.Path)
+			}
+			if isRest && i != len(splitPath(mr.Path))-1 {
+				return fmt.Errorf("route path %q: {%s*} must be the last segment", mr.Path, name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown route match %q", mr.Match)
+	}
+	return nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func parseSegment(segment string) (name string, isParam, isRest bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return segment, false, false
+	}
+	name = segment[1 : len(segment)-1]
+	if strings.HasSuffix(name, "*") {
+		return strings.TrimSuffix(name, "*"), true, true
+	}
+	return name, true, false
+}
+
+// matchPath reports whether path is served by the route and returns path parameters
+// and a score; routes with higher score win.
+func (mr *MockRoute) matchPath(path string) (params map[string]string, score int, ok bool) {
+	params = map[string]string{}
+	switch mr.Match {
+	case matchExact:
+		if strings.TrimSuffix(path, "/") == strings.TrimSuffix(mr.Path, "/") {
+			return params, 3 << 16, true
+		}
+	case matchPrefix:
+		// the prefix ends at a segment boundary: /api matches /api/v1 but not /apiv2
+		if path == mr.Path || strings.HasPrefix(path, strings.TrimSuffix(mr.Path, "/")+"/") {
+			return params, len(mr.Path), true
+		}
+	case matchPattern:
+		segments := splitPath(path)
+		patterns := splitPath(mr.Path)
+		literals := 0
+		for i, pattern := range patterns {
+			name, isParam, isRest := parseSegment(pattern)
+			if isRest {
+				if i > len(segments) {
+					return nil, 0, false
+				}
+				params[name] = strings.Join(segments[i:], "/")
+				return params, 1<<16 + literals, true
+			}
+			if i >= len(segments) {
+				return nil, 0, false
+			}
+			if isParam {
+				params[name] = segments[i]
+			} else if name != segments[i] {
+				return nil, 0, false
+			} else {
+				literals++
+			}
+		}
+		if len(segments) == len(patterns) {
+			return params, 2<<16 + literals, true
+		}
+	}
+	return nil, 0, false
+}
+
+func (mr *MockRoute) matchMethod(method string) bool {
+	return mr.Method == "" || strings.EqualFold(mr.Method, method)
+}
+
+// matchMockRoute picks the best route: exact paths first, then patterns with
+// more literal segments, then the longest prefix. Ties are broken by precedes.
+func matchMockRoute(routes []*MockRoute, method, path string) (*MockRoute, map[string]string, bool) {
+	var found *MockRoute
+	var foundParams map[string]string
+	foundScore := -1
+	for _, route := range routes {
+		if !route.matchMethod(method) {
+			continue
+		}
+		params, score, ok := route.matchPath(path)
+		if ok && (score > foundScore || score == foundScore && route.precedes(found)) {
+			found, foundParams, foundScore = route, params, score
+		}
+	}
+	return found, foundParams, found != nil
+}
+
+// precedes orders routes of the same score: routes of sessions with a required
+// scenario state win over unscoped ones, then the smaller id wins.
+func (mr *MockRoute) precedes(other *MockRoute) bool {
+	if scoped, otherScoped := mr.hasRequiredState(), other.hasRequiredState(); scoped != otherScoped {
+		return scoped
+	}
+	return mr.Id < other.Id
+}
+
+func (mr *MockRoute) hasRequiredState() bool {
+	session, found := LocalStore.GetSession(mr.Session)
+	return found && session.RequiredState != ""
+}
+
+// isMockPath reports whether any route serves path regardless of the method.
+func isMockPath(routes []*MockRoute, path string) bool {
+	for _, route := range routes {
+		if _, _, ok := route.matchPath(path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func serveMockRoute(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection, route *MockRoute, params map[string]string) int {
+	session, found := LocalStore.GetSession(route.Session)
+	if !found {
+		return respSessionNotFound(w, route.Session)
+	}
+	if session.GraphQL {
+		return serveGraphQL(w, r, session, "", collection)
+	}
+	if isWebSocketRequest(r, session) {
+		return serveWebSocket(w, r, session, params, "", collection)
+	}
+	if session.Stream != nil {
+		return serveEvents(w, r, session, params, "", collection)
+	}
+
+	hash := requestSeed(r)
+	if hash == "" {
+		hash = getHash()
+	}
+	simulateDelay(r, session, hash)
+	result, err := renderSession(session, hash, r, params, collection)
+	if err != nil {
+		return respRenderError(w, err)
+	}
+	LocalScenarios.transit(session)
+	return writeResult(w, result, session)
+}
+
+type routesByPath []*MockRoute
+
+func (s routesByPath) Len() int      { return len(s) }
+func (s routesByPath) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s routesByPath) Less(i, j int) bool {
+	if s[i].Path != s[j].Path {
+		return s[i].Path < s[j].Path
+	}
+	return s[i].Method < s[j].Method
+}
+
+// routesAdmin serves GET/POST /routes and GET/DELETE /routes/{id}.
+func routesAdmin(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	routeId := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(routesPath, "/")), "/")
+	if routeId == "" {
+		switch r.Method {
+		case http.MethodGet:
+			routes := LocalStore.Routes()
+			sort.Sort(routesByPath(routes))
+			return respJson(w, http.StatusOK, routes)
+		case http.MethodPost:
+			return createRoute(w, r, collection)
+		default:
+			return respMethodNotAllowed(w, r)
+		}
+	}
+
+	route, found := LocalStore.GetRoute(routeId)
+	if !found {
+		return respError(w, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("route %s not found", routeId), nil)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return respJson(w, http.StatusOK, route)
+	case http.MethodDelete:
+		if err := LocalStore.DeleteRoute(route.Id); err != nil {
+			return respInternalServerError(w, err)
+		}
+		if route.OwnSession {
+			if err := LocalStore.DeleteSession(route.Session); err != nil {
+				return respInternalServerError(w, err)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent
+	default:
+		return respMethodNotAllowed(w, r)
+	}
+}
+
+// defaultMatch is pattern for paths with {name} segments and exact otherwise.
+func defaultMatch(path string) string {
+	if strings.Contains(path, "{") {
+		return matchPattern
+	}
+	return matchExact
+}
+
+// createRoute registers a route either for an existing session (`session` parameter,
+// fault_* parameters then apply to the route only) or for a new session made from
+// the request body like /init does.
+// Route sessions never expire unless session_ttl_min is set.
+func createRoute(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	q := r.URL.Query()
+	route := &MockRoute{
+		Id:      getHash(),
+		Method:  strings.ToUpper(q.Get(formKeyRouteMethod)),
+		Path:    q.Get(formKeyRoutePath),
+		Match:   q.Get(formKeyRouteMatch),
+		Session: q.Get(formKeyRouteSession),
+	}
+	if route.Match == "" {
+		route.Match = defaultMatch(route.Path)
+	}
+	if err := route.validate(); err != nil {
+		return respInvalidOption(w, err)
+	}
+
+	if route.Session != "" {
+		if _, found := LocalStore.GetSession(route.Session); !found {
+			return respError(w, http.StatusBadRequest, errCodeSessionNotFound,
+				fmt.Sprintf("session %s not found or expired", route.Session), map[string]string{"session": route.Session})
+		}
+		fault, _, err := parseFaultPolicy(r)
+		if err != nil {
+			return respInvalidOption(w, err)
+		}
+		route.Fault = fault
+	} else {
+		userTpl, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return respInternalServerError(w, err)
+		}
+		defer r.Body.Close()
+
+		ttl := cache.NoExpiration
+		if q.Get(formKeySessionTtlMin) != "" {
+			if ttl, err = parseTtlMin(r); err != nil {
+				return respInvalidTtl(w, err)
+			}
+		}
+
+		session := &Session{
+			Uuid:        getHash(),
+			Template:    string(userTpl),
+			ContentType: defaultContentType,
+		}
+		if err := parseSessionOptions(r, session); err != nil {
+			return respInvalidOption(w, err)
+		}
+		if errs := validateSession(session, collection); errs != nil {
+			return respInvalidTemplate(w, errs)
+		}
+		if err := LocalStore.SetSession(session, ttl); err != nil {
+			return respInternalServerError(w, err)
+		}
+		route.Session = session.Uuid
+		route.OwnSession = true
+	}
+
+	if err := LocalStore.SetRoute(route); err != nil {
+		return respInternalServerError(w, err)
+	}
+	return respJson(w, http.StatusCreated, route)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchMockRoute(t *testing.T) {
+	routes := []*MockRoute{
+		{Id: "prefix", Path: "/api/", Match: matchPrefix},
+		{Id: "user", Method: http.MethodGet, Path: "/api/v1/users/{id}", Match: matchPattern},
+		{Id: "me", Method: http.MethodGet, Path: "/api/v1/users/me", Match: matchExact},
+		{Id: "orders", Method: http.MethodPost, Path: "/orders", Match: matchExact},
+		{Id: "files", Path: "/files/{bucket}/{path*}", Match: matchPattern},
+		{Id: "static", Path: "/static", Match: matchPrefix},
+	}
+
+	cases := []struct {
+		method, path string
+		id           string
+		params       map[string]string
+	}{
+		{http.MethodGet, "/api/v1/users/42", "user", map[string]string{"id": "42"}},
+		{http.MethodGet, "/api/v1/users/me", "me", map[string]string{}},
+		{http.MethodDelete, "/api/v1/users/42", "prefix", map[string]string{}},
+		{http.MethodGet, "/api/v1/users/42/posts", "prefix", map[string]string{}},
+		{http.MethodPost, "/orders/", "orders", map[string]string{}},
+		{http.MethodGet, "/orders", "", nil},
+		{http.MethodGet, "/files/b/a/b/c.txt", "files", map[string]string{"bucket": "b", "path": "a/b/c.txt"}},
+		{http.MethodGet, "/unknown", "", nil},
+		{http.MethodGet, "/static", "static", map[string]string{}},
+		{http.MethodGet, "/static/css/app.css", "static", map[string]string{}},
+		{http.MethodGet, "/staticfiles", "", nil},
+		{http.MethodGet, "/apiv2", "", nil},
+	}
+	for _, c := range cases {
+		route, params, ok := matchMockRoute(routes, c.method, c.path)
+		if c.id == "" {
+			if ok {
+				t.Errorf("%s %s: expected no route; actual %s", c.method, c.path, route.Id)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s %s: expected route %s; actual none", c.method, c.path, c.id)
+			continue
+		}
+		if route.Id != c.id {
+			t.Errorf("%s %s: expected route %s; actual %s", c.method, c.path, c.id, route.Id)
+		}
+		if len(params) != len(c.params) {
+			t.Errorf("%s %s: expected params %v; actual %v", c.method, c.path, c.params, params)
+		}
+		for k, v := range c.params {
+			if params[k] != v {
+				t.Errorf("%s %s: param %s expected %q; actual %q", c.method, c.path, k, v, params[k])
+			}
+		}
+	}
+}
+
+func TestMatchMockRouteTie(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalStore.SetSession(&Session{Uuid: "order", Template: "any"}, 0)
+	LocalStore.SetSession(&Session{Uuid: "order-paid", Template: "paid", Scenario: "order", RequiredState: "paid"}, 0)
+	a := &MockRoute{Id: "a", Path: "/order", Match: matchExact, Session: "order"}
+	b := &MockRoute{Id: "b", Path: "/order", Match: matchExact, Session: "order"}
+	paid := &MockRoute{Id: "paid", Path: "/order", Match: matchExact, Session: "order-paid"}
+
+	cases := []struct {
+		routes []*MockRoute
+		id     string
+	}{
+		{[]*MockRoute{a, b}, "a"},
+		{[]*MockRoute{b, a}, "a"},
+		{[]*MockRoute{a, paid, b}, "paid"},
+		{[]*MockRoute{paid, b, a}, "paid"},
+	}
+	for _, c := range cases {
+		route, _, ok := matchMockRoute(c.routes, http.MethodGet, "/order")
+		if !ok || route.Id != c.id {
+			t.Errorf("expected route %s; actual %+v", c.id, route)
+		}
+	}
+}
+
+func TestMockRouteValidate(t *testing.T) {
+	invalid := []*MockRoute{
+		{Path: "api", Match: matchExact},
+		{Path: "/api", Match: "regexp"},
+		{Path: "/api/{}", Match: matchPattern},
+		{Path: "/api/{rest*}/tail", Match: matchPattern},
+	}
+	for _, route := range invalid {
+		if err := route.validate(); err == nil {
+			t.Errorf("route %+v expected to be invalid", route)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const scenariosPath string = "/scenarios/"
+
+// scenarioStarted is the state of every scenario before its first transition.
+const scenarioStarted = "Started"
+
+const (
+	formKeyScenario      = "scenario"
+	formKeyRequiredState = "required_state"
+	formKeyNewState      = "new_state"
+	formKeyState         = "state"
+)
+
+// Scenarios keeps the current state of named scenarios.
+type Scenarios struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func newScenarios() *Scenarios {
+	return &Scenarios{states: make(map[string]string)}
+}
+
+var LocalScenarios = newScenarios()
+
+func (s *Scenarios) State(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return scenarioStarted
+}
+
+func (s *Scenarios) SetState(name, state string) {
+	s.mu.Lock()
+	s.states[name] = state
+	s.mu.Unlock()
+}
+
+// Reset puts the scenario back to scenarioStarted.
+func (s *Scenarios) Reset(name string) {
+	s.mu.Lock()
+	delete(s.states, name)
+	s.mu.Unlock()
+}
+
+func (s *Scenarios) ResetAll() {
+	s.mu.Lock()
+	s.states = make(map[string]string)
+	s.mu.Unlock()
+}
+
+// isActive reports whether the session may respond in the current state of its scenario.
+func (s *Scenarios) isActive(session *Session) bool {
+	return session.Scenario == "" || session.RequiredState == "" || s.State(session.Scenario) == session.RequiredState
+}
+
+// transit moves the scenario of the session to its new state after a response.
+func (s *Scenarios) transit(session *Session) {
+	if session.Scenario == "" || session.NewState == "" {
+		return
+	}
+	if from := s.State(session.Scenario); from != session.NewState {
+		log.Printf("scenario %s: %s -> %s", session.Scenario, from, session.NewState)
+		s.SetState(session.Scenario, session.NewState)
+	}
+}
+
+// activeRoutes filters out routes whose sessions are waiting for another scenario state.
+func activeRoutes(routes []*MockRoute) []*MockRoute {
+	active := make([]*MockRoute, 0, len(routes))
+	for _, route := range routes {
+		if session, found := LocalStore.GetSession(route.Session); found && LocalScenarios.isActive(session) {
+			active = append(active, route)
+		}
+	}
+	return active
+}
+
+// scenariosAdmin serves GET /scenarios, POST /scenarios/reset,
+// PUT /scenarios/{name}?state=... and POST /scenarios/{name}/reset.
+func scenariosAdmin(w http.ResponseWriter, r *http.Request, _ *generator.RandomDataCollection) int {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(scenariosPath, "/")), "/")
+	name, action := path, ""
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		name, action = path[:i], path[i+1:]
+	} else if path == "reset" {
+		name, action = "", path
+	}
+
+	switch {
+	case name == "" && action == "" && r.Method == http.MethodGet:
+		return respJson(w, http.StatusOK, scenarioStates())
+	case name == "" && action == "reset" && r.Method == http.MethodPost:
+		LocalScenarios.ResetAll()
+		log.Println("all scenarios reset")
+		return respJson(w, http.StatusOK, scenarioStates())
+	case name != "" && action == "reset" && r.Method == http.MethodPost:
+		LocalScenarios.Reset(name)
+		return respJson(w, http.StatusOK, scenarioStates())
+	case name != "" && action == "" && r.Method == http.MethodPut:
+		state := r.URL.Query().Get(formKeyState)
+		if state == "" {
+			return respInvalidOption(w, fmt.Errorf("%s is required", formKeyState))
+		}
+		LocalScenarios.SetState(name, state)
+		return respJson(w, http.StatusOK, scenarioStates())
+	case name != "" && action == "" && r.Method == http.MethodGet:
+		return respJson(w, http.StatusOK, map[string]string{name: LocalScenarios.State(name)})
+	default:
+		return respMethodNotAllowed(w, r)
+	}
+}
+
+// scenarioStates returns states of scenarios used by sessions and of those set explicitly.
+func scenarioStates() map[string]string {
+	names := make(map[string]bool)
+	for _, session := range LocalStore.Sessions() {
+		if session.Scenario != "" {
+			names[session.Scenario] = true
+		}
+	}
+	LocalScenarios.mu.Lock()
+	for name := range LocalScenarios.states {
+		names[name] = true
+	}
+	LocalScenarios.mu.Unlock()
+
+	states := make(map[string]string, len(names))
+	for name := range names {
+		states[name] = LocalScenarios.State(name)
+	}
+	return states
+}
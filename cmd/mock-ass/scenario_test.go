@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScenarioTransitions(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalScenarios = newScenarios()
+	collection := initTestCollection(t)
+	handler := newAppHandler(collection,
+		Route{path: routesPath, hand: routesAdmin, prefix: true},
+		Route{path: scenariosPath, hand: scenariosAdmin, prefix: true},
+	)
+
+	for _, route := range []struct{ query, body string }{
+		{"?method=GET&path=/order&scenario=order&required_state=Started", "pending"},
+		{"?method=POST&path=/pay&scenario=order&new_state=paid", "ok"},
+		{"?method=GET&path=/order&scenario=order&required_state=paid", "paid"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routes/"+route.query, strings.NewReader(route.body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create route %s: status expected %d; actual %d", route.query, http.StatusCreated, w.Code)
+		}
+	}
+
+	steps := []struct {
+		method, path string
+		body         string
+	}{
+		{http.MethodGet, "/order", "pending"},
+		{http.MethodGet, "/order", "pending"},
+		{http.MethodPost, "/pay", "ok"},
+		{http.MethodGet, "/order", "paid"},
+		{http.MethodPost, "/scenarios/order/reset", ""},
+		{http.MethodGet, "/order", "pending"},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(step.method, step.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %s: status expected %d; actual %d", step.method, step.path, http.StatusOK, w.Code)
+		}
+		if step.body != "" && w.Body.String() != step.body {
+			t.Errorf("%s %s: body expected %q; actual %q", step.method, step.path, step.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/scenarios/order?state=shipped", nil))
+	if state := LocalScenarios.State("order"); state != "shipped" {
+		t.Errorf("state expected 'shipped'; actual %q", state)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /order in state shipped: status expected %d; actual %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestScenarioSessionRedirect(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalScenarios = newScenarios()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?scenario=order&required_state=Started&new_state=paid", strings.NewReader(`{"status": "pending"}`)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sessionResp.Url, nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("first GET: status expected %d; actual %d", http.StatusTemporaryRedirect, w.Code)
+	}
+	if state := LocalScenarios.State("order"); state != "paid" {
+		t.Errorf("state expected 'paid'; actual %q", state)
+	}
+
+	// the redirect is followed after the transition
+	location := w.Header().Get("Location")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status": "pending"}` {
+		t.Errorf("redirect: 200 and the cached render expected; actual %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sessionResp.Url, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET in state paid: status expected %d; actual %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+// formKeySchema marks the request body as a JSON Schema instead of a template.
+const formKeySchema = "schema"
+
+func parseSchemaFlag(raw string) (bool, error) {
+	schema, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", formKeySchema, raw)
+	}
+	return schema, nil
+}
+
+// renderSchema generates a document conforming to the session schema.
+func renderSchema(session *Session, hash string, collection *generator.RandomDataCollection) (string, error) {
+	schema, err := generator.ParseSchema([]byte(session.Template))
+	if err != nil {
+		return "", err
+	}
+	return generator.GenerateFromSchema(schema, hash, collection)
+}
+
+// validateSchema checks the session schema parses and a document can be generated from it.
+func validateSchema(session *Session, collection *generator.RandomDataCollection) []*ValidationError {
+	if _, err := renderSchema(session, getHash(), collection); err != nil {
+		return []*ValidationError{{TemplateError: &generator.TemplateError{Message: err.Error()}}}
+	}
+	return nil
+}
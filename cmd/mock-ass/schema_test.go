@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInitSchema(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?schema=true",
+		strings.NewReader(`{"properties": {"user": {"$ref": "#/definitions/missing"}}}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unresolved $ref") {
+		t.Errorf("unresolved $ref expected to be rejected; actual %d %s", w.Code, w.Body.String())
+	}
+
+	schema := `{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer", "minimum": 1, "maximum": 9}}}`
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?schema=true", strings.NewReader(schema)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sessionResp.Url, nil))
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil))
+	var doc struct{ Id int }
+	if err := json.Unmarshal(w2.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("generated document %q: %v", w2.Body.String(), err)
+	}
+	if doc.Id < 1 || doc.Id > 9 {
+		t.Errorf("id expected in 1..9; actual %d", doc.Id)
+	}
+	if contentType := w2.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("content type expected application/json; actual %q", contentType)
+	}
+}
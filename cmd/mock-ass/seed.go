@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const (
+	// formKeySeed is the hash to render with, renders with a seed are deterministic
+	formKeySeed = "seed"
+	// formKeyDeterministic makes every render of the session deterministic
+	formKeyDeterministic = "deterministic"
+)
+
+type renderFunc func(template, hash string, collection *generator.RandomDataCollection, extra map[string]interface{}) (string, error)
+
+func parseDeterministicFlag(raw string) (bool, error) {
+	deterministic, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", formKeyDeterministic, raw)
+	}
+	return deterministic, nil
+}
+
+// requestSeed returns the seed query parameter of r, if any.
+func requestSeed(r *http.Request) string {
+	if r.URL == nil {
+		return ""
+	}
+	return r.URL.Query().Get(formKeySeed)
+}
+
+// sessionRenderer renders templates of the session deterministically if the
+// session is deterministic or the request has a seed.
+func sessionRenderer(session *Session, r *http.Request) renderFunc {
+	if session.Deterministic || requestSeed(r) != "" {
+		return generator.RenderDeterministic
+	}
+	return generator.RenderWithContext
+}
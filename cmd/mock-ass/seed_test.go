@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const randomTemplate = `{"name": "{{ FullName() }}", "email": "{{ Email() }}", "age": {{ Number(18, 90) }}, "ip": "{{ IPv4() }}"}`
+
+func TestSeed(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init", strings.NewReader(randomTemplate)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	get := func(seed string) string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sessionResp.Url+"&seed="+seed, nil))
+		if w.Code != http.StatusOK || w.Header().Get(hashHeader) != seed {
+			t.Fatalf("seed %s: status %d, hash %q", seed, w.Code, w.Header().Get(hashHeader))
+		}
+		return w.Body.String()
+	}
+	out := get("abc")
+	for i := 0; i < 3; i++ {
+		if again := get("abc"); again != out {
+			t.Fatalf("renders of the same seed differ:\n%s\n%s", out, again)
+		}
+	}
+	if other := get("abd"); other == out {
+		t.Errorf("renders of different seeds expected to differ: %s", out)
+	}
+}
+
+func TestDeterministicSession(t *testing.T) {
+	collection := initTestCollection(t)
+	session := &Session{Template: randomTemplate, Headers: map[string]string{"X-Id": "{{ NumberString(1000000) }}"}}
+	r := httptest.NewRequest(http.MethodPost, "/init?deterministic=true", nil)
+	if err := parseSessionOptions(r, session); err != nil || !session.Deterministic {
+		t.Fatalf("deterministic session expected; actual %v %+v", err, session)
+	}
+
+	result, err := renderSession(session, "hash", trialRequest(), nil, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		again, err := renderSession(session, "hash", trialRequest(), nil, collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Body != result.Body || again.Headers["X-Id"] != result.Headers["X-Id"] {
+			t.Fatalf("renders of the same hash differ:\n%+v\n%+v", result, again)
+		}
+	}
+}
+
+func TestChainKeysAcrossRoutes(t *testing.T) {
+	LocalStore = newMemoryStore()
+	LocalScenarios = newScenarios()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: routesPath, hand: routesAdmin, prefix: true},
+	)
+	for path, body := range map[string]string{
+		"/users/{id}":      `{{ FullNameChain(request.params.id) }} <{{ EmailChain(request.params.id) }}>`,
+		"/users/{id}/card": `Card of {{ FullNameChain(request.params.id) }} <{{ EmailChain(request.params.id) }}>`,
+	} {
+		q := url.Values{"method": {"GET"}, "path": {path}, "content_type": {"text/plain"}}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routes/?"+q.Encode(), strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create route %s: status %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?seed=abc", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, w.Code)
+		}
+		return w.Body.String()
+	}
+	user := get("/users/u-42")
+	if card := get("/users/u-42/card"); card != "Card of "+user {
+		t.Errorf("the card expected to show %q; actual %q", user, card)
+	}
+	if other := get("/users/u-43"); other == user {
+		t.Errorf("users expected to differ: %q", user)
+	}
+}
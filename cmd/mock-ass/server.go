@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -13,6 +14,10 @@ type HandlerFunc func(http.ResponseWriter, *http.Request, *generator.RandomDataC
 type Route struct {
 	path string
 	hand HandlerFunc
+	// prefix routes also serve every path under path
+	prefix bool
+	// session returns the uuid of the session the request is for, if any
+	session func(*http.Request) string
 }
 
 type AppHandler struct {
@@ -37,17 +42,70 @@ func newAppHandler(collection *generator.RandomDataCollection, routes ...Route)
 	return h
 }
 
+func (h *AppHandler) findRoute(path string) (Route, bool) {
+	if route, ok := h.routes[path]; ok {
+		return route, true
+	}
+	var found Route
+	for _, route := range h.routes {
+		if !route.prefix || !strings.HasSuffix(route.path, "/") {
+			continue
+		}
+		if strings.HasPrefix(path, route.path) && len(route.path) > len(found.path) {
+			found = route
+		}
+	}
+	return found, found.hand != nil
+}
+
 func (h *AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if route, ok := h.routes[r.URL.Path]; ok {
-		statusCode := route.hand(w, r, h.collection)
-		if statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices {
-			log.Printf("[%s] %s — %d", r.Method, r.URL.String(), statusCode)
-		} else {
-			log.Printf("[%s] %s — %d", r.Method, r.URL.String(), statusCode)
+	if route, ok := h.findRoute(r.URL.Path); ok {
+		var policy *FaultPolicy
+		var entry *JournalEntry
+		var session *Session
+		if route.session != nil {
+			if session, ok = LocalStore.GetSession(route.session(r)); ok {
+				policy = session.Fault
+				entry = newJournalEntry(r)
+			}
 		}
+		statusCode := serveWithFault(w, r, policy, func(w http.ResponseWriter) int {
+			return route.hand(w, r, h.collection)
+		})
+		if entry != nil {
+			entry.Status = statusCode
+			entry.Hash = w.Header().Get(hashHeader)
+			LocalJournal.Record(session.Uuid, entry)
+		}
+		log.Printf("[%s] %s — %d", r.Method, r.URL.String(), statusCode)
 		return
-	} else {
-		log.Printf("[%s] %s — %d", r.Method, r.URL.String(), 404)
-		http.NotFound(w, r)
 	}
+
+	routes := LocalStore.Routes()
+	if mock, params, ok := matchMockRoute(activeRoutes(routes), r.Method, r.URL.Path); ok {
+		entry := newJournalEntry(r)
+		entry.Route = mock.Id
+		statusCode := serveWithFault(w, r, mock.faultPolicy(), func(w http.ResponseWriter) int {
+			return serveMockRoute(w, r, h.collection, mock, params)
+		})
+		entry.Status = statusCode
+		entry.Hash = w.Header().Get(hashHeader)
+		LocalJournal.Record(mock.Session, entry)
+		log.Printf("[%s] %s — %d (route %s)", r.Method, r.URL.String(), statusCode, mock.Id)
+		return
+	}
+	if r.Method == http.MethodOptions && isMockPath(routes, r.URL.Path) {
+		setCorsHeaders(w)
+		log.Printf("[%s] %s — %d", r.Method, r.URL.String(), http.StatusOK)
+		return
+	}
+
+	if LocalRecorder != nil {
+		statusCode := LocalRecorder.serve(w, r, h.collection)
+		log.Printf("[%s] %s — %d (proxied)", r.Method, r.URL.String(), statusCode)
+		return
+	}
+
+	log.Printf("[%s] %s — %d", r.Method, r.URL.String(), http.StatusNotFound)
+	respError(w, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path), nil)
 }
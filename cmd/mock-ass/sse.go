@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const (
+	formKeySse         = "sse"
+	formKeySseInterval = "sse_interval"
+	formKeySseCount    = "sse_count"
+	formKeySseEvent    = "sse_event"
+)
+
+const (
+	defaultEventInterval = time.Second
+	minEventInterval     = time.Millisecond
+)
+
+// EventStream serves a session as Server-Sent Events: the template is rendered
+// for every event with a hash derived from the stream seed and the event number.
+type EventStream struct {
+	Interval time.Duration `json:"interval"`
+	// Count of events, the stream is endless if zero
+	Count int `json:"count,omitempty"`
+	// Event is the type of events, they have no type if empty
+	Event string `json:"event,omitempty"`
+}
+
+// parseEventStream applies sse query parameters to stream: sse=false turns the
+// stream off, sse=true or any sse_* parameter turns it on.
+func parseEventStream(q url.Values, stream *EventStream) (*EventStream, error) {
+	if raw := q.Get(formKeySse); raw != "" {
+		on, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", formKeySse, raw)
+		}
+		if !on {
+			return nil, nil
+		}
+		if stream == nil {
+			stream = &EventStream{Interval: defaultEventInterval}
+		}
+	}
+	for _, key := range []string{formKeySseInterval, formKeySseCount, formKeySseEvent} {
+		if _, ok := q[key]; ok && stream == nil {
+			stream = &EventStream{Interval: defaultEventInterval}
+		}
+	}
+	if stream == nil {
+		return nil, nil
+	}
+
+	next := *stream
+	if raw := q.Get(formKeySseInterval); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < minEventInterval {
+			return nil, fmt.Errorf("invalid %s %q", formKeySseInterval, raw)
+		}
+		next.Interval = interval
+	}
+	if raw := q.Get(formKeySseCount); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid %s %q", formKeySseCount, raw)
+		}
+		next.Count = count
+	}
+	if _, ok := q[formKeySseEvent]; ok {
+		event := q.Get(formKeySseEvent)
+		if strings.ContainsAny(event, "\r\n") {
+			return nil, fmt.Errorf("invalid %s %q", formKeySseEvent, event)
+		}
+		next.Event = event
+	}
+	return &next, nil
+}
+
+// eventHash is the render hash of the event n of the stream.
+func eventHash(seed string, n int) string {
+	return fmt.Sprintf("%s-%d", seed, n)
+}
+
+// eventId is the id of the event n of the stream, it has the seed to resume the stream.
+func eventId(seed string, n int) string {
+	return fmt.Sprintf("%s:%d", seed, n)
+}
+
+func parseEventId(id string) (seed string, n int, ok bool) {
+	i := strings.LastIndex(id, ":")
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(id[i+1:])
+	if err != nil || n < 1 {
+		return "", 0, false
+	}
+	return id[:i], n, true
+}
+
+func writeEvent(w io.Writer, id, event, data string) {
+	fmt.Fprintf(w, "id: %s\n", id)
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	io.WriteString(w, "\n")
+}
+
+// serveEvents streams the session from the event after Last-Event-ID, or from
+// the first event of the seed (a new one if empty).
+func serveEvents(w http.ResponseWriter, r *http.Request, session *Session, params map[string]string, seed string, collection *generator.RandomDataCollection) int {
+	stream := session.Stream
+	next := 1
+	if lastSeed, n, ok := parseEventId(r.Header.Get("Last-Event-ID")); ok {
+		seed, next = lastSeed, n+1
+	}
+	if seed == "" {
+		seed = requestSeed(r)
+	}
+	if seed == "" {
+		seed = getHash()
+	}
+	if stream.Count > 0 && next > stream.Count {
+		// the stream is over, 204 stops reconnects of EventSource
+		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent
+	}
+
+	// events derive every value from the seed, so a resumed stream goes on
+	// with the same events
+	eventSession := *session
+	eventSession.Deterministic = true
+
+	simulateDelay(r, session, seed)
+	result, err := renderSession(&eventSession, eventHash(seed, next), r, params, collection)
+	if err != nil {
+		return respRenderError(w, err)
+	}
+	LocalScenarios.transit(session)
+
+	for name, value := range result.Headers {
+		setHeader(w.Header(), name, value)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(hashHeader, seed)
+	setCorsHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	ticker := time.NewTicker(stream.Interval)
+	defer ticker.Stop()
+	for n := next; ; n++ {
+		if n > next {
+			if result, err = renderSession(&eventSession, eventHash(seed, n), r, params, collection); err != nil {
+				log.Printf("session %s: event %d: %v", session.Uuid, n, err)
+				break
+			}
+		}
+		writeEvent(w, eventId(seed, n), stream.Event, result.Body)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if stream.Count > 0 && n >= stream.Count {
+			break
+		}
+		select {
+		case <-r.Context().Done():
+			return http.StatusOK
+		case <-ticker.C:
+		}
+	}
+	return http.StatusOK
+}
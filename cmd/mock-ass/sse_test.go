@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeEvents(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init?sse_interval=1ms&sse_count=3&sse_event=user",
+		strings.NewReader(`{"hash": "{{ hash }}", "name": "{{ FullNameChain(1) }}", "age": {{ Number(1, 1000000) }}}`)))
+	var sessionResp SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessionResp); err != nil {
+		t.Fatalf("init response %q: %v", w.Body.String(), err)
+	}
+
+	stream := func(lastEventId string) string {
+		r := httptest.NewRequest(http.MethodGet, sessionResp.Url+"&h=seed", nil)
+		if lastEventId != "" {
+			r.Header.Set("Last-Event-ID", lastEventId)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if contentType := w.Header().Get("Content-Type"); w.Code == http.StatusOK && contentType != "text/event-stream" {
+			t.Errorf("content type expected text/event-stream; actual %q", contentType)
+		}
+		return w.Body.String()
+	}
+
+	body := stream("")
+	events := strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n")
+	if len(events) != 3 {
+		t.Fatalf("events expected 3; actual %d: %q", len(events), body)
+	}
+	for i, event := range events {
+		prefix := fmt.Sprintf("id: seed:%d\nevent: user\ndata: {\"hash\": \"seed-%d\", \"name\": ", i+1, i+1)
+		if !strings.HasPrefix(event, prefix) {
+			t.Errorf("event %d expected to start with %q; actual %q", i+1, prefix, event)
+		}
+	}
+	if again := stream(""); again != body {
+		t.Errorf("streams of the same seed differ:\n%s\n%s", body, again)
+	}
+
+	if resumed := stream("seed:2"); resumed != events[2]+"\n\n" {
+		t.Errorf("stream after seed:2 expected %q; actual %q", events[2]+"\n\n", resumed)
+	}
+	r := httptest.NewRequest(http.MethodGet, sessionResp.Url, nil)
+	r.Header.Set("Last-Event-ID", "seed:3")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("stream after the last event: status expected %d; actual %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestParseEventStream(t *testing.T) {
+	for _, query := range []string{"sse=maybe", "sse_interval=0s", "sse_count=-1", "sse_event=a%0Ab"} {
+		r := httptest.NewRequest(http.MethodPost, "/init?"+query, nil)
+		if err := parseSessionOptions(r, &Session{}); err == nil {
+			t.Errorf("%s: error expected", query)
+		}
+	}
+
+	session := &Session{}
+	parseSessionOptions(httptest.NewRequest(http.MethodPost, "/init?sse=true", nil), session)
+	if session.Stream == nil || session.Stream.Interval != defaultEventInterval {
+		t.Errorf("sse=true: stream with the default interval expected; actual %+v", session.Stream)
+	}
+	parseSessionOptions(httptest.NewRequest(http.MethodPut, "/sessions/x?sse=false", nil), session)
+	if session.Stream != nil {
+		t.Errorf("sse=false: no stream expected; actual %+v", session.Stream)
+	}
+}
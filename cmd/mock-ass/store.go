@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pmylund/go-cache"
+)
+
+const (
+	defaultCacheExpiration time.Duration = 60 * time.Minute
+	cacheCleanupInterval   time.Duration = 30 * time.Second
+)
+
+// Session is a user template registered with /init.
+type Session struct {
+	Uuid        string `json:"uuid"`
+	Template    string `json:"template"`
+	ContentType string `json:"content_type"`
+	// Status of rendered responses, http.StatusOK if zero
+	Status int `json:"status,omitempty"`
+	// Headers are header templates rendered with the same hash as Template
+	Headers map[string]string `json:"headers,omitempty"`
+	// Delay is applied before the rendered response is written
+	Delay *Delay `json:"delay,omitempty"`
+	// Fault is checked before anything is rendered
+	Fault *FaultPolicy `json:"fault,omitempty"`
+	// Scenario the session takes part in: it responds only in RequiredState (any
+	// state if empty) and moves the scenario to NewState (if set) after a response
+	Scenario      string `json:"scenario,omitempty"`
+	RequiredState string `json:"required_state,omitempty"`
+	NewState      string `json:"new_state,omitempty"`
+	// Format pretty-prints or minifies JSON and XML responses
+	Format string `json:"format,omitempty"`
+	// OutputCheck rejects templates rendering output invalid for ContentType, it's
+	// set by an explicit content type unless output_check turns it off
+	OutputCheck bool `json:"output_check,omitempty"`
+	// Schema means Template is a JSON Schema responses are generated from
+	Schema bool `json:"schema,omitempty"`
+	// Deterministic renders derive every value from the hash, not only *Chain functions
+	Deterministic bool `json:"deterministic,omitempty"`
+	// GraphQL means Template is a GraphQL schema (SDL) queries are answered from
+	GraphQL bool `json:"graphql,omitempty"`
+	// Stream serves the session as Server-Sent Events instead of single responses
+	Stream *EventStream `json:"stream,omitempty"`
+	// WebSocket serves WebSocket upgrade requests of the session
+	WebSocket *WebSocket `json:"websocket,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	// Transient sessions are not persisted with -state-dir, they come from
+	// definition files or OpenAPI imports which are loaded again on start
+	Transient bool `json:"-"`
+}
+
+// Result is a rendered session template cached under its hash.
+type Result struct {
+	Session   string            `json:"session"`
+	Hash      string            `json:"hash"`
+	Body      string            `json:"body"`
+	Status    int               `json:"status,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// SessionStore keeps sessions and their rendered results.
+// A zero ttl means defaultCacheExpiration, cache.NoExpiration keeps the item forever.
+type SessionStore interface {
+	GetSession(uuid string) (*Session, bool)
+	SetSession(session *Session, ttl time.Duration) error
+	Sessions() []*Session
+	DeleteSession(uuid string) error
+
+	GetResult(hash string) (*Result, bool)
+	SetResult(result *Result, ttl time.Duration) error
+	Results(sessionUuid string) []*Result
+	DeleteResults(sessionUuid string) error
+
+	GetRoute(id string) (*MockRoute, bool)
+	SetRoute(route *MockRoute) error
+	Routes() []*MockRoute
+	DeleteRoute(id string) error
+
+	// ReplaceMocks installs sessions (without expiration and cached results) and
+	// routes and deletes the sessions and routes of the given ids in one step.
+	ReplaceMocks(sessions []*Session, routes []*MockRoute, deleteSessions, deleteRoutes []string) error
+
+	Close() error
+}
+
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl == cache.DefaultExpiration {
+		ttl = defaultCacheExpiration
+	}
+	if ttl == cache.NoExpiration {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// ttlUntil is the inverse of expiresAt; already expired times give the smallest positive ttl.
+func ttlUntil(t time.Time) time.Duration {
+	if t.IsZero() {
+		return cache.NoExpiration
+	}
+	if ttl := t.Sub(time.Now()); ttl > 0 {
+		return ttl
+	}
+	return time.Nanosecond
+}
+
+func getCacheSessionKey(sessionUuid string) string {
+	return fmt.Sprintf("session_%s", sessionUuid)
+}
+
+func getCacheHashKey(hash string) string {
+	return fmt.Sprintf("hash_%s", hash)
+}
+
+// memoryStore is a SessionStore on top of go-cache. It keeps an index of
+// session results because the cache itself cannot be safely iterated.
+type memoryStore struct {
+	cache *cache.Cache
+
+	// swap is held by ReplaceMocks, so sessions and routes are read
+	// either before or after a swap
+	swap sync.RWMutex
+
+	mu      sync.Mutex
+	results map[string]map[string]bool // session uuid -> hashes
+	routes  map[string]*MockRoute
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		cache:   cache.New(defaultCacheExpiration, cacheCleanupInterval),
+		results: make(map[string]map[string]bool),
+		routes:  make(map[string]*MockRoute),
+	}
+	s.cache.OnEvicted(s.onEvicted)
+	return s
+}
+
+func (s *memoryStore) onEvicted(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch v := value.(type) {
+	case *Session:
+		delete(s.results, v.Uuid)
+	case *Result:
+		if hashes, ok := s.results[v.Session]; ok {
+			delete(hashes, v.Hash)
+		}
+	}
+}
+
+func (s *memoryStore) GetSession(uuid string) (*Session, bool) {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	if v, found := s.cache.Get(getCacheSessionKey(uuid)); found {
+		return v.(*Session), true
+	}
+	return nil, false
+}
+
+func (s *memoryStore) SetSession(session *Session, ttl time.Duration) error {
+	session.ExpiresAt = expiresAt(ttl)
+	s.setSession(session)
+	return nil
+}
+
+func (s *memoryStore) setSession(session *Session) {
+	s.mu.Lock()
+	if _, ok := s.results[session.Uuid]; !ok {
+		s.results[session.Uuid] = make(map[string]bool)
+	}
+	s.mu.Unlock()
+	s.cache.Set(getCacheSessionKey(session.Uuid), session, ttlUntil(session.ExpiresAt))
+}
+
+func (s *memoryStore) Sessions() []*Session {
+	s.mu.Lock()
+	uuids := make([]string, 0, len(s.results))
+	for uuid := range s.results {
+		uuids = append(uuids, uuid)
+	}
+	s.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(uuids))
+	for _, uuid := range uuids {
+		if session, found := s.GetSession(uuid); found {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func (s *memoryStore) DeleteSession(uuid string) error {
+	s.DeleteResults(uuid)
+	s.cache.Delete(getCacheSessionKey(uuid))
+	s.mu.Lock()
+	delete(s.results, uuid)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) GetResult(hash string) (*Result, bool) {
+	if v, found := s.cache.Get(getCacheHashKey(hash)); found {
+		return v.(*Result), true
+	}
+	return nil, false
+}
+
+func (s *memoryStore) SetResult(result *Result, ttl time.Duration) error {
+	result.ExpiresAt = expiresAt(ttl)
+	s.setResult(result)
+	return nil
+}
+
+func (s *memoryStore) setResult(result *Result) {
+	s.mu.Lock()
+	hashes, ok := s.results[result.Session]
+	if !ok {
+		hashes = make(map[string]bool)
+		s.results[result.Session] = hashes
+	}
+	hashes[result.Hash] = true
+	s.mu.Unlock()
+	s.cache.Set(getCacheHashKey(result.Hash), result, ttlUntil(result.ExpiresAt))
+}
+
+func (s *memoryStore) Results(sessionUuid string) []*Result {
+	s.mu.Lock()
+	hashes := make([]string, 0, len(s.results[sessionUuid]))
+	for hash := range s.results[sessionUuid] {
+		hashes = append(hashes, hash)
+	}
+	s.mu.Unlock()
+
+	results := make([]*Result, 0, len(hashes))
+	for _, hash := range hashes {
+		if result, found := s.GetResult(hash); found {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (s *memoryStore) DeleteResults(sessionUuid string) error {
+	s.mu.Lock()
+	hashes := s.results[sessionUuid]
+	if hashes != nil {
+		s.results[sessionUuid] = make(map[string]bool)
+	}
+	s.mu.Unlock()
+
+	for hash := range hashes {
+		s.cache.Delete(getCacheHashKey(hash))
+	}
+	return nil
+}
+
+func (s *memoryStore) GetRoute(id string) (*MockRoute, bool) {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	route, found := s.routes[id]
+	return route, found
+}
+
+func (s *memoryStore) SetRoute(route *MockRoute) error {
+	s.mu.Lock()
+	s.routes[route.Id] = route
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Routes() []*MockRoute {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	routes := make([]*MockRoute, 0, len(s.routes))
+	for _, route := range s.routes {
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+func (s *memoryStore) DeleteRoute(id string) error {
+	s.mu.Lock()
+	delete(s.routes, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) ReplaceMocks(sessions []*Session, routes []*MockRoute, deleteSessions, deleteRoutes []string) error {
+	s.swap.Lock()
+	defer s.swap.Unlock()
+	for _, session := range sessions {
+		session.ExpiresAt = time.Time{}
+		s.setSession(session)
+		s.DeleteResults(session.Uuid)
+	}
+	for _, route := range routes {
+		s.SetRoute(route)
+	}
+	for _, id := range deleteRoutes {
+		s.DeleteRoute(id)
+	}
+	for _, uuid := range deleteSessions {
+		s.DeleteSession(uuid)
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFileName = "sessions.log"
+
+var errStoreClosed = errors.New("state file is closed")
+
+const (
+	recordSession       = "session"
+	recordResult        = "result"
+	recordDeleteSession = "delete_session"
+	recordDeleteResults = "delete_results"
+	recordRoute         = "route"
+	recordDeleteRoute   = "delete_route"
+)
+
+// storeRecord is a single line of the append-only state file.
+type storeRecord struct {
+	Kind    string     `json:"kind"`
+	Session *Session   `json:"session,omitempty"`
+	Result  *Result    `json:"result,omitempty"`
+	Route   *MockRoute `json:"route,omitempty"`
+	Uuid    string     `json:"uuid,omitempty"`
+}
+
+// compactMinRecords is the number of records appended since the last compaction
+// that compacts the state file again, if they also outnumber the live records.
+var compactMinRecords = 10000
+
+// fileStore keeps everything in a memoryStore and appends every change to
+// a state file, which is replayed and compacted on startup and as it grows.
+// Transient sessions and routes are kept in memory only.
+type fileStore struct {
+	*memoryStore
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// live is the number of records written by the last compaction,
+	// appended the number of records appended since
+	live     int
+	appended int
+}
+
+func newFileStore(stateDir string) (*fileStore, error) {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+	s := &fileStore{
+		memoryStore: newMemoryStore(),
+		path:        filepath.Join(stateDir, stateFileName),
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("error on load %s: %v", s.path, err)
+	}
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("error on compact %s: %v", s.path, err)
+	}
+	return s, nil
+}
+
+func (s *fileStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	isAlive := func(t time.Time) bool {
+		return t.IsZero() || t.After(now)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// the last line may be cut by a crash, skip it and keep going
+			log.Printf("skip broken record %s:%d: %v", s.path, line, err)
+			continue
+		}
+		switch {
+		case rec.Kind == recordSession && rec.Session != nil && isAlive(rec.Session.ExpiresAt):
+			s.memoryStore.setSession(rec.Session)
+		case rec.Kind == recordResult && rec.Result != nil && isAlive(rec.Result.ExpiresAt):
+			s.memoryStore.setResult(rec.Result)
+		case rec.Kind == recordDeleteSession:
+			s.memoryStore.DeleteSession(rec.Uuid)
+		case rec.Kind == recordDeleteResults:
+			s.memoryStore.DeleteResults(rec.Uuid)
+		case rec.Kind == recordRoute && rec.Route != nil:
+			s.memoryStore.SetRoute(rec.Route)
+		case rec.Kind == recordDeleteRoute:
+			s.memoryStore.DeleteRoute(rec.Uuid)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the state file with live items only and reopens it for appending.
+func (s *fileStore) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compactLocked()
+}
+
+func (s *fileStore) compactLocked() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	live := 0
+	for _, session := range s.memoryStore.Sessions() {
+		if session.Transient {
+			continue
+		}
+		if err := enc.Encode(storeRecord{Kind: recordSession, Session: session}); err != nil {
+			tmp.Close()
+			return err
+		}
+		live++
+		for _, result := range s.memoryStore.Results(session.Uuid) {
+			if err := enc.Encode(storeRecord{Kind: recordResult, Result: result}); err != nil {
+				tmp.Close()
+				return err
+			}
+			live++
+		}
+	}
+	for _, route := range s.memoryStore.Routes() {
+		if route.Transient {
+			continue
+		}
+		if err := enc.Encode(storeRecord{Kind: recordRoute, Route: route}); err != nil {
+			tmp.Close()
+			return err
+		}
+		live++
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	s.live, s.appended = live, 0
+	return err
+}
+
+func (s *fileStore) append(rec storeRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errStoreClosed
+	}
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.appended++
+	if s.appended >= compactMinRecords && s.appended > s.live {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+func (s *fileStore) SetSession(session *Session, ttl time.Duration) error {
+	if err := s.memoryStore.SetSession(session, ttl); err != nil || session.Transient {
+		return err
+	}
+	return s.append(storeRecord{Kind: recordSession, Session: session})
+}
+
+func (s *fileStore) SetResult(result *Result, ttl time.Duration) error {
+	if err := s.memoryStore.SetResult(result, ttl); err != nil {
+		return err
+	}
+	if session, found := s.memoryStore.GetSession(result.Session); found && session.Transient {
+		return nil
+	}
+	return s.append(storeRecord{Kind: recordResult, Result: result})
+}
+
+func (s *fileStore) DeleteSession(uuid string) error {
+	if err := s.memoryStore.DeleteSession(uuid); err != nil {
+		return err
+	}
+	return s.append(storeRecord{Kind: recordDeleteSession, Uuid: uuid})
+}
+
+func (s *fileStore) DeleteResults(sessionUuid string) error {
+	if err := s.memoryStore.DeleteResults(sessionUuid); err != nil {
+		return err
+	}
+	return s.append(storeRecord{Kind: recordDeleteResults, Uuid: sessionUuid})
+}
+
+func (s *fileStore) SetRoute(route *MockRoute) error {
+	if err := s.memoryStore.SetRoute(route); err != nil || route.Transient {
+		return err
+	}
+	return s.append(storeRecord{Kind: recordRoute, Route: route})
+}
+
+func (s *fileStore) DeleteRoute(id string) error {
+	if err := s.memoryStore.DeleteRoute(id); err != nil {
+		return err
+	}
+	return s.append(storeRecord{Kind: recordDeleteRoute, Uuid: id})
+}
+
+func (s *fileStore) ReplaceMocks(sessions []*Session, routes []*MockRoute, deleteSessions, deleteRoutes []string) error {
+	if err := s.memoryStore.ReplaceMocks(sessions, routes, deleteSessions, deleteRoutes); err != nil {
+		return err
+	}
+	records := make([]storeRecord, 0, 2*len(sessions)+len(routes)+len(deleteSessions)+len(deleteRoutes))
+	for _, session := range sessions {
+		if !session.Transient {
+			records = append(records,
+				storeRecord{Kind: recordSession, Session: session},
+				storeRecord{Kind: recordDeleteResults, Uuid: session.Uuid})
+		}
+	}
+	for _, route := range routes {
+		if !route.Transient {
+			records = append(records, storeRecord{Kind: recordRoute, Route: route})
+		}
+	}
+	for _, id := range deleteRoutes {
+		records = append(records, storeRecord{Kind: recordDeleteRoute, Uuid: id})
+	}
+	for _, uuid := range deleteSessions {
+		records = append(records, storeRecord{Kind: recordDeleteSession, Uuid: uuid})
+	}
+	for _, rec := range records {
+		if err := s.append(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmylund/go-cache"
+)
+
+func TestFileStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newFileStore(dir)
+	if err != nil {
+		t.Fatalf("newFileStore error: %v", err)
+	}
+	store.SetSession(&Session{Uuid: "alive", Template: "{{ hash }}", ContentType: "text/plain"}, time.Hour)
+	store.SetSession(&Session{Uuid: "forever", Template: "forever"}, cache.NoExpiration)
+	store.SetSession(&Session{Uuid: "expired", Template: "expired"}, time.Nanosecond)
+	store.SetResult(&Result{Session: "alive", Hash: "h1", Body: "h1"}, time.Hour)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newFileStore(dir)
+	if err != nil {
+		t.Fatalf("newFileStore error: %v", err)
+	}
+	defer store.Close()
+
+	session, found := store.GetSession("alive")
+	if !found {
+		t.Fatal("session 'alive' not found after reload")
+	}
+	if session.Template != "{{ hash }}" || session.ContentType != "text/plain" {
+		t.Errorf("session 'alive' restored as %+v", session)
+	}
+	if ttl := ttlUntil(session.ExpiresAt); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("session 'alive' ttl expected in (0, 1h]; actual %v", ttl)
+	}
+	if session, found := store.GetSession("forever"); !found || !session.ExpiresAt.IsZero() {
+		t.Errorf("session 'forever' expected without expiration; actual %+v", session)
+	}
+	if _, found := store.GetSession("expired"); found {
+		t.Error("session 'expired' must not be restored")
+	}
+
+	result, found := store.GetResult("h1")
+	if !found || result.Body != "h1" || result.Session != "alive" {
+		t.Errorf("result 'h1' restored as %+v", result)
+	}
+	if results := store.Results("alive"); len(results) != 1 {
+		t.Errorf("results of 'alive' expected 1; actual %d", len(results))
+	}
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(n int) { compactMinRecords = n }(compactMinRecords)
+	compactMinRecords = 10
+
+	store, err := newFileStore(dir)
+	if err != nil {
+		t.Fatalf("newFileStore error: %v", err)
+	}
+	defer store.Close()
+	for i := 0; i < 100; i++ {
+		store.SetSession(&Session{Uuid: "s", Template: strconv.Itoa(i)}, time.Hour)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines > compactMinRecords {
+		t.Errorf("state file expected compacted to at most %d records; actual %d", compactMinRecords, lines)
+	}
+}
+
+func TestFileStoreTransient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-ass-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newFileStore(dir)
+	if err != nil {
+		t.Fatalf("newFileStore error: %v", err)
+	}
+	store.SetSession(&Session{Uuid: "mock", Template: "mock", Transient: true}, cache.NoExpiration)
+	store.SetResult(&Result{Session: "mock", Hash: "h1", Body: "h1"}, time.Hour)
+	store.SetRoute(&MockRoute{Id: "mock", Path: "/mock", Match: matchExact, Session: "mock", Transient: true})
+	store.SetSession(&Session{Uuid: "kept", Template: "kept"}, time.Hour)
+	store.SetRoute(&MockRoute{Id: "kept", Path: "/kept", Match: matchExact, Session: "kept"})
+	if _, found := store.GetRoute("mock"); !found {
+		t.Error("transient route must be kept in memory")
+	}
+	if err := store.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newFileStore(dir)
+	if err != nil {
+		t.Fatalf("newFileStore error: %v", err)
+	}
+	defer store.Close()
+	if _, found := store.GetSession("mock"); found {
+		t.Error("transient session must not be restored")
+	}
+	if _, found := store.GetResult("h1"); found {
+		t.Error("result of a transient session must not be restored")
+	}
+	if _, found := store.GetRoute("mock"); found {
+		t.Error("transient route must not be restored")
+	}
+	if _, found := store.GetSession("kept"); !found {
+		t.Error("session 'kept' not found after reload")
+	}
+	if _, found := store.GetRoute("kept"); !found {
+		t.Error("route 'kept' not found after reload")
+	}
+}
+
+func TestReplaceMocks(t *testing.T) {
+	store := newMemoryStore()
+	store.SetSession(&Session{Uuid: "old", Template: "old"}, cache.NoExpiration)
+	store.SetRoute(&MockRoute{Id: "old", Path: "/old", Match: matchExact, Session: "old"})
+	store.SetSession(&Session{Uuid: "kept", Template: "v1"}, time.Hour)
+	store.SetResult(&Result{Session: "kept", Hash: "h1", Body: "v1"}, time.Hour)
+
+	err := store.ReplaceMocks(
+		[]*Session{{Uuid: "kept", Template: "v2"}},
+		[]*MockRoute{{Id: "kept", Path: "/kept", Match: matchExact, Session: "kept"}},
+		[]string{"old"}, []string{"old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.GetSession("old"); found {
+		t.Error("session 'old' expected deleted")
+	}
+	if _, found := store.GetRoute("old"); found {
+		t.Error("route 'old' expected deleted")
+	}
+	session, found := store.GetSession("kept")
+	if !found || session.Template != "v2" || !session.ExpiresAt.IsZero() {
+		t.Errorf("session 'kept' expected replaced without expiration; actual %+v", session)
+	}
+	if _, found := store.GetResult("h1"); found {
+		t.Error("results of replaced sessions expected dropped")
+	}
+	if _, found := store.GetRoute("kept"); !found {
+		t.Error("route 'kept' not found")
+	}
+}
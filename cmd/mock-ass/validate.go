@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const validatePath string = "/validate"
+
+// maxOutputSample limits the rendered output reported with an output error.
+const maxOutputSample = 4 << 10
+
+// ValidationError is a problem of the session template or, if Header is set, of a header template.
+// Errors of rendered output have Output set to the rendered sample, Line and Column point into it.
+type ValidationError struct {
+	Header string `json:"header,omitempty"`
+	// Reply is the pattern of the WebSocket reply with the error
+	Reply  string `json:"reply,omitempty"`
+	Output string `json:"output,omitempty"`
+	*generator.TemplateError
+}
+
+type ValidateResponse struct {
+	Valid  bool               `json:"valid"`
+	Errors []*ValidationError `json:"errors"`
+}
+
+// trialRequest stands for the incoming request in trial renders.
+func trialRequest() *http.Request {
+	return &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: "/"},
+		Header: make(http.Header),
+	}
+}
+
+// validateSession checks the template (or the schema) and header templates of session
+// with a trial render; it returns nil if they're valid.
+func validateSession(session *Session, collection *generator.RandomDataCollection) []*ValidationError {
+	extra := map[string]interface{}{
+		"request": newTemplateRequest(trialRequest(), nil),
+	}
+	if session.GraphQL {
+		return validateGraphQL(session)
+	}
+	var errs []*ValidationError
+	if session.Schema {
+		errs = validateSchema(session, collection)
+	} else {
+		for _, e := range generator.Validate(session.Template, collection, extra) {
+			errs = append(errs, &ValidationError{TemplateError: e})
+		}
+	}
+
+	names := make([]string, 0, len(session.Headers))
+	for name := range session.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, e := range generator.Validate(session.Headers[name], collection, extra) {
+			errs = append(errs, &ValidationError{Header: name, TemplateError: e})
+		}
+	}
+	if session.WebSocket != nil {
+		for _, reply := range session.WebSocket.Replies {
+			replyExtra := replyContext(trialRequest(), nil, "")
+			replyExtra["data"] = nil
+			for _, e := range generator.Validate(reply.Template, collection, replyExtra) {
+				errs = append(errs, &ValidationError{Reply: reply.Match, TemplateError: e})
+			}
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	if session.Schema {
+		// generated documents are valid JSON
+		return nil
+	}
+	out, err := checkSessionOutput(session, func(hash string) (string, error) {
+		return generator.RenderDeterministic(session.Template, hash, collection, extra)
+	})
+	if err != nil {
+		e := &ValidationError{TemplateError: &generator.TemplateError{Message: err.Error()}}
+		if oerr, ok := err.(*OutputError); ok {
+			e.Line, e.Column = oerr.Line, oerr.Column
+		}
+		if e.Output = out; len(out) > maxOutputSample {
+			e.Output = out[:maxOutputSample]
+		}
+		return []*ValidationError{e}
+	}
+	return nil
+}
+
+// validationMessage joins the messages of errs.
+func validationMessage(errs []*ValidationError) string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return "invalid template: " + strings.Join(messages, "; ")
+}
+
+func respInvalidTemplate(w http.ResponseWriter, errs []*ValidationError) int {
+	return respError(w, http.StatusBadRequest, errCodeInvalidTemplate, validationMessage(errs), errs)
+}
+
+// validateTemplate serves POST /validate: the body is a template, query parameters
+// are the same as for /init, e.g. header=Name: value templates are checked too.
+func validateTemplate(w http.ResponseWriter, r *http.Request, collection *generator.RandomDataCollection) int {
+	if r.Method != http.MethodPost {
+		return respMethodNotAllowed(w, r)
+	}
+	userTpl, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return respInternalServerError(w, err)
+	}
+	defer r.Body.Close()
+
+	session := &Session{Template: string(userTpl), ContentType: defaultContentType}
+	if err := parseSessionOptions(r, session); err != nil {
+		return respInvalidOption(w, err)
+	}
+	errs := validateSession(session, collection)
+	if errs == nil {
+		errs = []*ValidationError{}
+	}
+	return respJson(w, http.StatusOK, &ValidateResponse{Valid: len(errs) == 0, Errors: errs})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	LocalStore = newMemoryStore()
+	handler := newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: validatePath, hand: validateTemplate},
+	)
+
+	query := "?header=" + url.QueryEscape("X-Total: {{ Count() }}")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate"+query, strings.NewReader("{\n  \"a\": {{ FirstName( }}\n}")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("validate status expected %d; actual %d", http.StatusOK, w.Code)
+	}
+	var resp ValidateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("validate response %q: %v", w.Body.String(), err)
+	}
+	if resp.Valid || len(resp.Errors) != 2 {
+		t.Fatalf("validate expected 2 errors; actual %s", w.Body.String())
+	}
+	if e := resp.Errors[0]; e.Header != "" || e.Line != 2 || e.Token != "}}" {
+		t.Errorf("template error expected at line 2 near '}}'; actual %+v", e.TemplateError)
+	}
+	if e := resp.Errors[1]; e.Header != "X-Total" || e.Function != "Count" {
+		t.Errorf("header error expected for unknown function Count; actual %+v", e)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"a": "{{ FirstName() }}"}`)))
+	if !strings.Contains(w.Body.String(), `"valid":true`) {
+		t.Errorf("valid template expected; actual %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init", strings.NewReader(`{{ FristName() }}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"function":"FristName"`) {
+		t.Errorf("init of an invalid template expected to fail with 400 and errors; actual %d %s", w.Code, w.Body.String())
+	}
+	if sessions := LocalStore.Sessions(); len(sessions) != 0 {
+		t.Errorf("no sessions expected; actual %d", len(sessions))
+	}
+}
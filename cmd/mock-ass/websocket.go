@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wolfmetr/mock-ass/generator"
+)
+
+const (
+	formKeyWs         = "ws"
+	formKeyWsInterval = "ws_interval"
+	formKeyWsCount    = "ws_count"
+	formKeyWsReply    = "ws_reply"
+)
+
+// wsReplySeparator separates the pattern and the template of ws_reply.
+const wsReplySeparator = " => "
+
+const wsWriteTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{
+	// mocks are called from any origin, like CORS headers allow
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocket serves a session over WebSocket connections: the session template is
+// pushed on connect and every Interval, incoming messages are answered with the
+// template of the first matching reply.
+type WebSocket struct {
+	// Interval between pushed messages, the template is pushed once if zero
+	Interval time.Duration `json:"interval,omitempty"`
+	// Count limits pushed messages, unlimited if zero
+	Count   int               `json:"count,omitempty"`
+	Replies []*WebSocketReply `json:"replies,omitempty"`
+}
+
+// WebSocketReply answers messages matching the Match regexp with Template.
+// The template has the message text as `message` and, if it's JSON, its value as `data`.
+type WebSocketReply struct {
+	Match    string `json:"match"`
+	Template string `json:"template"`
+}
+
+// parseWebSocket applies ws query parameters to ws: ws=false turns WebSocket off,
+// ws=true or any ws_* parameter turns it on. ws_reply replaces all replies.
+func parseWebSocket(q url.Values, ws *WebSocket) (*WebSocket, error) {
+	if raw := q.Get(formKeyWs); raw != "" {
+		on, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", formKeyWs, raw)
+		}
+		if !on {
+			return nil, nil
+		}
+		if ws == nil {
+			ws = &WebSocket{}
+		}
+	}
+	for _, key := range []string{formKeyWsInterval, formKeyWsCount, formKeyWsReply} {
+		if _, ok := q[key]; ok && ws == nil {
+			ws = &WebSocket{}
+		}
+	}
+	if ws == nil {
+		return nil, nil
+	}
+
+	next := *ws
+	if raw := q.Get(formKeyWsInterval); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid %s %q", formKeyWsInterval, raw)
+		}
+		next.Interval = interval
+	}
+	if raw := q.Get(formKeyWsCount); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid %s %q", formKeyWsCount, raw)
+		}
+		next.Count = count
+	}
+	if raws, ok := q[formKeyWsReply]; ok {
+		next.Replies = nil
+		for _, raw := range raws {
+			i := strings.Index(raw, wsReplySeparator)
+			if i < 0 {
+				return nil, fmt.Errorf("invalid %s %q, expected 'pattern%stemplate'", formKeyWsReply, raw, wsReplySeparator)
+			}
+			reply := &WebSocketReply{Match: raw[:i], Template: raw[i+len(wsReplySeparator):]}
+			if _, err := regexp.Compile(reply.Match); err != nil {
+				return nil, fmt.Errorf("invalid %s pattern: %v", formKeyWsReply, err)
+			}
+			next.Replies = append(next.Replies, reply)
+		}
+	}
+	return &next, nil
+}
+
+// isWebSocketRequest reports whether r should be upgraded for the session.
+func isWebSocketRequest(r *http.Request, session *Session) bool {
+	return session.WebSocket != nil && websocket.IsWebSocketUpgrade(r)
+}
+
+// replyContext is the template context of a reply to message.
+func replyContext(r *http.Request, params map[string]string, message string) map[string]interface{} {
+	ctx := map[string]interface{}{
+		"request": newTemplateRequest(r, params),
+		"message": message,
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(message), &data); err == nil {
+		ctx["data"] = data
+	}
+	return ctx
+}
+
+// serveWebSocket upgrades the connection and serves the session until the client
+// disconnects; seed derives hashes of messages like event streams.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, session *Session, params map[string]string, seed string, collection *generator.RandomDataCollection) int {
+	if seed == "" {
+		seed = requestSeed(r)
+	}
+	if seed == "" {
+		seed = getHash()
+	}
+	ws := session.WebSocket
+	replies := make([]*regexp.Regexp, len(ws.Replies))
+	for i, reply := range ws.Replies {
+		var err error
+		if replies[i], err = regexp.Compile(reply.Match); err != nil {
+			return respInternalServerError(w, err)
+		}
+	}
+
+	header := http.Header{hashHeader: []string{seed}}
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		// the upgrader has responded already
+		log.Printf("session %s: %v", session.Uuid, err)
+		return http.StatusBadRequest
+	}
+	defer conn.Close()
+	w.Header().Set(hashHeader, seed)
+	LocalScenarios.transit(session)
+
+	incoming := make(chan string)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case incoming <- string(message):
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	send := func(message string) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			log.Printf("session %s: %v", session.Uuid, err)
+			return false
+		}
+		return true
+	}
+
+	pushed := 0
+	pushedAll := func() bool {
+		return session.Template == "" || ws.Count > 0 && pushed >= ws.Count
+	}
+	push := func() bool {
+		if pushedAll() {
+			return true
+		}
+		pushed++
+		result, err := renderSession(session, eventHash(seed, pushed), r, params, collection)
+		if err != nil {
+			log.Printf("session %s: message %d: %v", session.Uuid, pushed, err)
+			return false
+		}
+		return send(result.Body)
+	}
+
+	if !push() {
+		return http.StatusSwitchingProtocols
+	}
+	var tick <-chan time.Time
+	if ws.Interval > 0 && !pushedAll() {
+		ticker := time.NewTicker(ws.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	received := 0
+	for {
+		select {
+		case <-tick:
+			if !push() {
+				return http.StatusSwitchingProtocols
+			}
+			if pushedAll() {
+				// nothing to push anymore, only replies
+				tick = nil
+			}
+		case message := <-incoming:
+			received++
+			for i, re := range replies {
+				if !re.MatchString(message) {
+					continue
+				}
+				out, err := sessionRenderer(session, r)(ws.Replies[i].Template, fmt.Sprintf("%s-reply-%d", seed, received),
+					collection, replyContext(r, params, message))
+				if err != nil {
+					log.Printf("session %s: reply %q: %v", session.Uuid, ws.Replies[i].Match, err)
+				} else if !send(out) {
+					return http.StatusSwitchingProtocols
+				}
+				break
+			}
+		case <-done:
+			return http.StatusSwitchingProtocols
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestServeWebSocket(t *testing.T) {
+	LocalStore = newMemoryStore()
+	server := httptest.NewServer(newAppHandler(initTestCollection(t),
+		Route{path: "/init", hand: initSession},
+		Route{path: "/session", hand: generateResp, session: sessionFromQuery},
+	))
+	defer server.Close()
+
+	query := url.Values{
+		"ws_count":    {"2"},
+		"ws_interval": {"1ms"},
+		"ws_reply": {
+			`^ping$ => pong`,
+			`"type":\s*"hello" => {"greeting": "hi {{ data.name }}", "hash": "{{ hash }}"}`,
+		},
+	}
+	resp, err := http.Post(server.URL+"/init?"+query.Encode(), "text/plain", strings.NewReader(`{"tick": "{{ hash }}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessionResp SessionResponse
+	err = json.NewDecoder(resp.Body).Decode(&sessionResp)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("init response: %v", err)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+sessionResp.Url+"&h=seed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if hash := resp.Header.Get(hashHeader); hash != "seed" {
+		t.Errorf("%s expected seed; actual %q", hashHeader, hash)
+	}
+
+	read := func() string {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(message)
+	}
+	for _, expected := range []string{`{"tick": "seed-1"}`, `{"tick": "seed-2"}`} {
+		if message := read(); message != expected {
+			t.Errorf("pushed message expected %q; actual %q", expected, message)
+		}
+	}
+
+	replies := []struct{ message, reply string }{
+		{"ping", "pong"},
+		{`{"type": "hello", "name": "Olivia"}`, `{"greeting": "hi Olivia", "hash": "seed-reply-2"}`},
+	}
+	for _, r := range replies {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(r.message)); err != nil {
+			t.Fatal(err)
+		}
+		if reply := read(); reply != r.reply {
+			t.Errorf("reply to %q expected %q; actual %q", r.message, r.reply, reply)
+		}
+	}
+
+	// sessions answer plain requests as usual
+	resp, err = http.Get(server.URL + sessionResp.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("plain request: status expected %d; actual %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestParseWebSocket(t *testing.T) {
+	for _, query := range []string{"ws=maybe", "ws_interval=x", "ws_count=-1", "ws_reply=ping", "ws_reply=%28%20%3D%3E%20pong"} {
+		r := httptest.NewRequest(http.MethodPost, "/init?"+query, nil)
+		if err := parseSessionOptions(r, &Session{}); err == nil {
+			t.Errorf("%s: error expected", query)
+		}
+	}
+}
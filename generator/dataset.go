@@ -0,0 +1,253 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/flosch/pongo2.v3"
+)
+
+// rowFunction is the dataset function returning the row number.
+const rowFunction = "Row"
+
+// Column is a column of a dataset: its values are results of the template
+// function called with Args. *Chain functions get the row number as the key
+// before Args, so `age: NumberChain(18, 90)` calls NumberChain(row, 18, 90).
+type Column struct {
+	Name     string
+	Function string
+	Args     []interface{}
+}
+
+// ParseColumn parses a column spec like `age: NumberChain(18, 90)`; parentheses
+// may be left out if there are no arguments. Arguments are numbers, quoted strings
+// and booleans.
+func ParseColumn(spec string) (*Column, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid column %q, expected 'name: Function(args)'", spec)
+	}
+	c := &Column{Name: strings.TrimSpace(spec[:i]), Function: strings.TrimSpace(spec[i+1:])}
+	if c.Name == "" {
+		return nil, fmt.Errorf("invalid column %q: the name is empty", spec)
+	}
+	if open := strings.Index(c.Function, "("); open >= 0 {
+		if !strings.HasSuffix(c.Function, ")") {
+			return nil, fmt.Errorf("column %s: unbalanced parentheses", c.Name)
+		}
+		raw := strings.TrimSpace(c.Function[open+1 : len(c.Function)-1])
+		c.Function = strings.TrimSpace(c.Function[:open])
+		if raw != "" {
+			for _, arg := range splitArgs(raw) {
+				v, err := parseArg(strings.TrimSpace(arg))
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %v", c.Name, err)
+				}
+				c.Args = append(c.Args, v)
+			}
+		}
+	}
+	if c.Function == "" {
+		return nil, fmt.Errorf("column %s: the function is empty", c.Name)
+	}
+	return c, nil
+}
+
+// ParseColumns parses a column spec per line; blank lines and # comments are skipped.
+func ParseColumns(spec string) ([]*Column, error) {
+	var columns []*Column
+	scanner := bufio.NewScanner(strings.NewReader(spec))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c, err := ParseColumn(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		columns = append(columns, c)
+	}
+	return columns, scanner.Err()
+}
+
+// splitArgs splits arguments on commas outside of quoted strings.
+func splitArgs(raw string) []string {
+	var args []string
+	start, quoted := 0, false
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				args = append(args, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, raw[start:])
+}
+
+func parseArg(raw string) (interface{}, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f, nil
+	}
+	if b, err := strconv.ParseBool(raw); err == nil {
+		return b, nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		if s, err := strconv.Unquote(raw); err == nil {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid argument %q", raw)
+}
+
+// Dataset generates rows of columns from a hash: the same hash gives the same rows
+// generated in order, functions without a key render deterministically.
+type Dataset struct {
+	Columns []*Column
+	funcs   []reflect.Value
+	args    [][]reflect.Value
+}
+
+// NewDataset checks the columns call template functions with fitting arguments.
+func NewDataset(columns []*Column, hash string, collection *RandomDataCollection) (*Dataset, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	ctx := newContext(NewDeterministicRandomData(hash, collection))
+	d := &Dataset{
+		Columns: columns,
+		funcs:   make([]reflect.Value, len(columns)),
+		args:    make([][]reflect.Value, len(columns)),
+	}
+	names := make(map[string]bool, len(columns))
+	for i, c := range columns {
+		if names[c.Name] {
+			return nil, fmt.Errorf("column %s is repeated", c.Name)
+		}
+		names[c.Name] = true
+		if c.Function == rowFunction {
+			if len(c.Args) > 0 {
+				return nil, fmt.Errorf("column %s: %s takes no arguments", c.Name, rowFunction)
+			}
+			continue
+		}
+
+		fn := reflect.ValueOf(ctx[c.Function])
+		if fn.Kind() != reflect.Func || fn.Type().NumOut() != 1 || c.Function == "Range" || c.Function == "Json" {
+			return nil, fmt.Errorf("column %s: unknown function %s", c.Name, c.Function)
+		}
+		args, key := c.Args, 0
+		if strings.HasSuffix(c.Function, "Chain") {
+			// the row key is set for every row
+			args, key = append([]interface{}{pongo2.AsValue(0)}, args...), 1
+		}
+		values, err := callArgs(fn.Type(), args, key)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %s: %v", c.Name, c.Function, err)
+		}
+		d.funcs[i], d.args[i] = fn, values
+	}
+	if err := d.trial(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// trial generates the first row, so arguments functions panic on, like the range of
+// NumberChain(90, 18), are reported before any output.
+func (d *Dataset) trial() error {
+	for i, c := range d.Columns {
+		if c.Function == rowFunction {
+			continue
+		}
+		if err := d.trialColumn(i); err != nil {
+			return fmt.Errorf("column %s: %s: %v", c.Name, c.Function, err)
+		}
+	}
+	return nil
+}
+
+func (d *Dataset) trialColumn(i int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	d.value(i, 1)
+	return nil
+}
+
+// callArgs converts args to parameters of the function type; errors don't count
+// the first skip arguments, which are set by the dataset.
+func callArgs(t reflect.Type, args []interface{}, skip int) ([]reflect.Value, error) {
+	required := t.NumIn()
+	if t.IsVariadic() {
+		required--
+	}
+	if len(args) < required || !t.IsVariadic() && len(args) > required {
+		return nil, fmt.Errorf("%d arguments expected, %d given", required-skip, len(args)-skip)
+	}
+	values := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if t.IsVariadic() && i >= required {
+			param = t.In(required).Elem()
+		} else {
+			param = t.In(i)
+		}
+		v := reflect.ValueOf(arg)
+		if !assignableArg(v.Kind(), param.Kind()) {
+			return nil, fmt.Errorf("argument %d: %v is not %s", i+1-skip, arg, param)
+		}
+		values[i] = v.Convert(param)
+	}
+	return values, nil
+}
+
+func assignableArg(arg, param reflect.Kind) bool {
+	switch param {
+	case reflect.Interface:
+		return true
+	case reflect.Int, reflect.Int64:
+		return arg == reflect.Int
+	case reflect.Float64:
+		return arg == reflect.Int || arg == reflect.Float64
+	}
+	return arg == param
+}
+
+// Row returns the values of row n (starting from 1).
+func (d *Dataset) Row(n int) []interface{} {
+	row := make([]interface{}, len(d.Columns))
+	for i, c := range d.Columns {
+		if c.Function == rowFunction {
+			row[i] = n
+			continue
+		}
+		row[i] = d.value(i, n)
+	}
+	return row
+}
+
+// value returns the value of column i in row n.
+func (d *Dataset) value(i, n int) interface{} {
+	args := d.args[i]
+	if strings.HasSuffix(d.Columns[i].Function, "Chain") {
+		args = append([]reflect.Value{reflect.ValueOf(pongo2.AsValue(n))}, args[1:]...)
+	}
+	return d.funcs[i].Call(args)[0].Interface()
+}
@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns(`
+# users
+id: Row
+name: FullNameChain
+age: NumberChain(18, 90)
+note: Literal("a, \"b\"")
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Column{
+		{Name: "id", Function: "Row"},
+		{Name: "name", Function: "FullNameChain"},
+		{Name: "age", Function: "NumberChain", Args: []interface{}{18, 90}},
+		{Name: "note", Function: "Literal", Args: []interface{}{`a, "b"`}},
+	}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("columns expected %v; actual %v", expected, columns)
+	}
+
+	for _, spec := range []string{"name", ": FullName", "age: NumberChain(18", "age: NumberChain(x)", "name:"} {
+		if _, err := ParseColumn(spec); err == nil {
+			t.Errorf("%q: error expected", spec)
+		}
+	}
+}
+
+func TestDataset(t *testing.T) {
+	collection := initTestCollection(t)
+	columns := []*Column{
+		{Name: "id", Function: "Row"},
+		{Name: "name", Function: "FullNameChain"},
+		{Name: "age", Function: "NumberChain", Args: []interface{}{18, 90}},
+		{Name: "score", Function: "FloatChain", Args: []interface{}{1, 2}},
+	}
+	d, err := NewDataset(columns, "seed", collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := NewDataset(columns, "seed", collection)
+	for n := 1; n <= 20; n++ {
+		row := d.Row(n)
+		if row[0] != n {
+			t.Errorf("row %d: id expected %d; actual %v", n, n, row[0])
+		}
+		if age := row[2].(int); age < 18 || age > 90 {
+			t.Errorf("row %d: age expected in 18..90; actual %d", n, age)
+		}
+		if !reflect.DeepEqual(row, again.Row(n)) {
+			t.Errorf("row %d differs for the same hash: %v %v", n, row, again.Row(n))
+		}
+	}
+	if reflect.DeepEqual(d.Row(1), d.Row(2)) {
+		t.Errorf("rows 1 and 2 expected to differ: %v", d.Row(1))
+	}
+
+	for _, c := range []*Column{
+		{Name: "x", Function: "Unknown"},
+		{Name: "x", Function: "Json"},
+		{Name: "x", Function: "EmailChain", Args: []interface{}{1}},
+		{Name: "x", Function: "NumberChain", Args: []interface{}{"a"}},
+		{Name: "x", Function: "Number", Args: []interface{}{1.5}},
+		{Name: "x", Function: "Row", Args: []interface{}{1}},
+		{Name: "x", Function: "NumberChain", Args: []interface{}{90, 18}},
+		{Name: "x", Function: "NumberChain", Args: []interface{}{5, 5}},
+	} {
+		if _, err := NewDataset([]*Column{c}, "seed", collection); err == nil {
+			t.Errorf("%s%v: error expected", c.Function, c.Args)
+		}
+	}
+	if _, err := NewDataset([]*Column{columns[0], columns[0]}, "seed", collection); err == nil {
+		t.Errorf("repeated column: error expected")
+	}
+}
@@ -1,6 +1,11 @@
 package generator
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"gopkg.in/flosch/pongo2.v3"
 )
 
@@ -12,13 +17,64 @@ func Range(size int) []int {
 	return sl
 }
 
+// Json marshals v for output as is, e.g. to echo a posted payload: {{ Json(request.json) }}
+// Values which can't be marshaled are rendered as null.
+func Json(v interface{}) *pongo2.Value {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return pongo2.AsSafeValue("null")
+	}
+	return pongo2.AsSafeValue(string(b))
+}
+
+// Compile checks the template syntax without rendering it.
+func Compile(template string) error {
+	_, err := pongo2.FromString(template)
+	return err
+}
+
 func Render(template string, hash string, collection *RandomDataCollection) (out string, err error) {
+	return RenderWithContext(template, hash, collection, nil)
+}
+
+// RenderWithContext renders template like Render with extra variables (e.g. the incoming request).
+// Extra variables can't override template functions and hash.
+func RenderWithContext(template string, hash string, collection *RandomDataCollection, extra map[string]interface{}) (out string, err error) {
+	return render(template, NewRandomData(hash, collection), extra)
+}
+
+// RenderDeterministic renders template like RenderWithContext, but functions without
+// a key (FirstName(), Number(1, 10), ...) derive their values from hash and the number
+// of calls before them: the same template and hash always give the same output.
+func RenderDeterministic(template string, hash string, collection *RandomDataCollection, extra map[string]interface{}) (out string, err error) {
+	return render(template, NewDeterministicRandomData(hash, collection), extra)
+}
+
+func render(template string, rd *RandomData, extra map[string]interface{}) (out string, err error) {
 	tpl, err := pongo2.FromString(template)
 	if err != nil {
 		return "", err
 	}
-	rd := NewRandomData(hash, collection)
-	out, err = tpl.Execute(pongo2.Context{
+	ctx := pongo2.Context{}
+	for k, v := range extra {
+		ctx[k] = v
+	}
+	ctx.Update(newContext(rd))
+	return execute(tpl, ctx)
+}
+
+// execute renders tpl turning panics of functions (e.g. Number(5, 5)) into errors.
+func execute(tpl *pongo2.Template, ctx pongo2.Context) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = "", &TemplateError{Message: fmt.Sprintf("function panicked: %v", r)}
+		}
+	}()
+	return tpl.Execute(ctx)
+}
+
+func newContext(rd *RandomData) pongo2.Context {
+	ctx := pongo2.Context{
 		"FirstName":               rd.FirstName,
 		"FirstNameChain":          rd.FirstNameChain,
 		"FirstNameMale":           rd.FirstNameMale,
@@ -41,34 +97,63 @@ func Render(template string, hash string, collection *RandomDataCollection) (out
 		"TwoLetterCountryChain":   rd.CountryCode2Chain,
 		"ThreeLetterCountry":      rd.CountryCode3,
 		"ThreeLetterCountryChain": rd.CountryCode3Chain,
-		"City":               rd.City,
-		"CityChain":          rd.CityChain,
-		"StateUsaCode":       rd.StateUsaCode,
-		"StateUsaCodeChain":  rd.StateUsaCodeChain,
-		"StateUsaName":       rd.StateUsaName,
-		"StateUsaNameChain":  rd.StateUsaNameChain,
-		"Number":             rd.Number,
-		"NumberChain":        rd.NumberChain,
-		"NumberString":       rd.NumberString,
-		"NumberStringChain":  rd.NumberStringChain,
-		"Decimal":            rd.Float,
-		"DecimalChain":       rd.FloatChain,
-		"Float":              rd.Float,
-		"FloatChain":         rd.FloatChain,
-		"Boolean":            rd.Boolean,
-		"BooleanChain":       rd.BooleanChain,
-		"BooleanString":      rd.BooleanString,
-		"BooleanStringChain": rd.BooleanStringChain,
-		"Paragraph":          rd.Paragraph,
-		"ParagraphChain":     rd.ParagraphChain,
-		"IPv4":               rd.IPv4,
-		"IPv4Chain":          rd.IPv4Chain,
-		"Range":              Range,
-		"hash":               hash,
-	})
-	if err != nil {
-		return "", err
+		"City":                    rd.City,
+		"CityChain":               rd.CityChain,
+		"StateUsaCode":            rd.StateUsaCode,
+		"StateUsaCodeChain":       rd.StateUsaCodeChain,
+		"StateUsaName":            rd.StateUsaName,
+		"StateUsaNameChain":       rd.StateUsaNameChain,
+		"Number":                  rd.Number,
+		"NumberChain":             rd.NumberChain,
+		"NumberString":            rd.NumberString,
+		"NumberStringChain":       rd.NumberStringChain,
+		"Decimal":                 rd.Float,
+		"DecimalChain":            rd.FloatChain,
+		"Float":                   rd.Float,
+		"FloatChain":              rd.FloatChain,
+		"Boolean":                 rd.Boolean,
+		"BooleanChain":            rd.BooleanChain,
+		"BooleanString":           rd.BooleanString,
+		"BooleanStringChain":      rd.BooleanStringChain,
+		"Paragraph":               rd.Paragraph,
+		"ParagraphChain":          rd.ParagraphChain,
+		"IPv4":                    rd.IPv4,
+		"IPv4Chain":               rd.IPv4Chain,
+		"Range":                   Range,
+		"Json":                    Json,
+		"hash":                    rd.hash,
+	}
+	for name, fn := range ctx {
+		if strings.HasSuffix(name, "Chain") {
+			ctx[name] = keyValueFunc(fn)
+		}
+	}
+	return ctx
+}
+
+var valueType = reflect.TypeOf(new(pongo2.Value))
+
+// keyValueFunc returns the *Chain function fn taking the key as a *pongo2.Value:
+// pongo2 can't pass nil to interface{} parameters, and keys may be missing, like
+// request.json.id of a request without a body.
+func keyValueFunc(fn interface{}) interface{} {
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
 	}
-	//out = strings.Replace(out, "\n", "\\n", -1)
-	return out, nil
+	in[0] = valueType
+	wrapped := reflect.FuncOf(in, []reflect.Type{t.Out(0)}, t.IsVariadic())
+	return reflect.MakeFunc(wrapped, func(args []reflect.Value) []reflect.Value {
+		key := reflect.New(t.In(0)).Elem()
+		if v := args[0].Interface().(*pongo2.Value).Interface(); v != nil {
+			key.Set(reflect.ValueOf(v))
+		}
+		args = append([]reflect.Value{key}, args[1:]...)
+		if t.IsVariadic() {
+			return f.CallSlice(args)
+		}
+		return f.Call(args)
+	}).Interface()
 }
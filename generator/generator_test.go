@@ -3,8 +3,10 @@ package generator
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -155,3 +157,70 @@ func TestRenderXml(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderPanic(t *testing.T) {
+	collection := initTestCollection(t)
+	for _, tpl := range []string{`{{ Number(5, 5) }}`, `{{ NumberChain(request.id, 90, 18) }}`} {
+		out, err := RenderWithContext(tpl, "hash", collection, map[string]interface{}{"request": map[string]interface{}{}})
+		if _, ok := err.(*TemplateError); !ok || out != "" {
+			t.Errorf("%s: a TemplateError expected; actual %q, %v", tpl, out, err)
+		}
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	collection := initTestCollection(t)
+	tpl := testTemplateJson + `{{ EmailChain(1) }} {{ FullNameChain(1) }}`
+
+	out, err := RenderDeterministic(tpl, "seed", collection, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if again, _ := RenderDeterministic(tpl, "seed", collection, nil); again != out {
+			t.Fatalf("renders of the same hash differ:\n%s\n%s", out, again)
+		}
+	}
+	if other, _ := RenderDeterministic(tpl, "other seed", collection, nil); other == out {
+		t.Errorf("renders of different hashes expected to differ")
+	}
+
+	// the email belongs to the chained person
+	var email, first, last string
+	tail := out[strings.LastIndex(out, "}")+1:]
+	if _, err := fmt.Sscanf(tail, "%s %s %s", &email, &first, &last); err != nil {
+		t.Fatalf("%q: %v", tail, err)
+	}
+	if prefix := strings.ToLower(first + "." + last + "."); !strings.HasPrefix(email, prefix) {
+		t.Errorf("EmailChain(1) expected to start with %q; actual %q", prefix, email)
+	}
+}
+
+func TestChainKeys(t *testing.T) {
+	rd := NewRandomData("hash", initTestCollection(t))
+	if rd.FullNameChain("u-42") != rd.FullNameChain("u-42") || rd.EmailChain("u-42") != rd.EmailChain("u-42") {
+		t.Error("values of the same string key expected to be equal")
+	}
+	if rd.FullNameChain("u-42") == rd.FullNameChain("u-43") && rd.EmailChain("u-42") == rd.EmailChain("u-43") {
+		t.Error("values of different keys expected to differ")
+	}
+	for _, key := range []interface{}{"42", int64(42), 42.0, uint8(42)} {
+		if actual, expected := rd.FullNameChain(key), rd.FullNameChain(42); actual != expected {
+			t.Errorf("key %T %v expected to be the same as 42: %q; actual %q", key, key, expected, actual)
+		}
+	}
+	if other := NewRandomData("other hash", rd.collection); other.EmailChain("u-42") == rd.EmailChain("u-42") {
+		t.Error("values of different hashes expected to differ")
+	}
+
+	// a missing key is a key too
+	tpl := `{{ FullNameChain(request.id) }} {{ NumberChain(request.id, 18, 90) }}`
+	extra := map[string]interface{}{"request": map[string]interface{}{}}
+	out, err := RenderWithContext(tpl, "hash", rd.collection, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := RenderWithContext(tpl, "hash", rd.collection, extra); again != out {
+		t.Errorf("renders of a missing key differ: %q, %q", out, again)
+	}
+}
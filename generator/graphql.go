@@ -0,0 +1,960 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GraphQL token kinds.
+const (
+	gqlEOF = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind   int
+	val    string
+	line   int
+	column int
+}
+
+func (t gqlToken) String() string {
+	if t.kind == gqlEOF {
+		return "<EOF>"
+	}
+	return strconv.Quote(t.val)
+}
+
+// gqlLexer splits GraphQL documents (schemas and queries) into tokens,
+// skipping whitespace, commas and comments.
+type gqlLexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+}
+
+func newGqlLexer(src string) *gqlLexer {
+	return &gqlLexer{src: src, line: 1, column: 1}
+}
+
+func (l *gqlLexer) errorf(line, column int, format string, args ...interface{}) *TemplateError {
+	return &TemplateError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *gqlLexer) advance(n int) {
+	for _, r := range l.src[l.pos : l.pos+n] {
+		if r == '\n' {
+			l.line++
+			l.column = 1
+		} else {
+			l.column++
+		}
+	}
+	l.pos += n
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+			l.advance(end)
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.advance(1)
+		} else {
+			break
+		}
+	}
+	t := gqlToken{line: l.line, column: l.column}
+	if l.pos >= len(l.src) {
+		return t, nil
+	}
+
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		t.kind, t.val = gqlPunct, "..."
+	case strings.IndexByte("!$&()+:=@[]{}|", c) >= 0:
+		t.kind, t.val = gqlPunct, rest[:1]
+	case isNameStart(c):
+		n := 1
+		for n < len(rest) && isNameChar(rest[n]) {
+			n++
+		}
+		t.kind, t.val = gqlName, rest[:n]
+	case c == '-' || c >= '0' && c <= '9':
+		n := 1
+		t.kind = gqlInt
+		for n < len(rest) {
+			d := rest[n]
+			if d >= '0' && d <= '9' {
+				n++
+			} else if d == '.' || d == 'e' || d == 'E' || (d == '+' || d == '-') && (rest[n-1] == 'e' || rest[n-1] == 'E') {
+				t.kind = gqlFloat
+				n++
+			} else {
+				break
+			}
+		}
+		t.val = rest[:n]
+		if _, err := strconv.ParseFloat(t.val, 64); err != nil {
+			return t, l.errorf(t.line, t.column, "invalid number %s", t.val)
+		}
+	case strings.HasPrefix(rest, `"""`):
+		end := strings.Index(rest[3:], `"""`)
+		if end < 0 {
+			return t, l.errorf(t.line, t.column, "unterminated string")
+		}
+		t.kind, t.val = gqlString, strings.TrimSpace(rest[3:3+end])
+		l.advance(end + 6)
+		return t, nil
+	case c == '"':
+		n := 1
+		for n < len(rest) && rest[n] != '"' && rest[n] != '\n' {
+			if rest[n] == '\\' {
+				n++
+			}
+			n++
+		}
+		if n >= len(rest) || rest[n] != '"' {
+			return t, l.errorf(t.line, t.column, "unterminated string")
+		}
+		s, err := strconv.Unquote(rest[:n+1])
+		if err != nil {
+			return t, l.errorf(t.line, t.column, "invalid string %s", rest[:n+1])
+		}
+		t.kind, t.val = gqlString, s
+		l.advance(n + 1)
+		return t, nil
+	default:
+		r, _ := utf8.DecodeRuneInString(rest)
+		return t, l.errorf(t.line, t.column, "unexpected character %q", r)
+	}
+	l.advance(len(t.val))
+	return t, nil
+}
+
+// gqlParser is a recursive descent parser with one token of lookahead.
+type gqlParser struct {
+	lexer *gqlLexer
+	token gqlToken
+}
+
+func newGqlParser(src string) (*gqlParser, error) {
+	p := &gqlParser{lexer: newGqlLexer(src)}
+	return p, p.advance()
+}
+
+func (p *gqlParser) advance() error {
+	t, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = t
+	return nil
+}
+
+func (p *gqlParser) errorf(format string, args ...interface{}) *TemplateError {
+	return p.lexer.errorf(p.token.line, p.token.column, format, args...)
+}
+
+func (p *gqlParser) peek(kind int, val string) bool {
+	return p.token.kind == kind && (val == "" || p.token.val == val)
+}
+
+// skip consumes the token if it matches.
+func (p *gqlParser) skip(kind int, val string) (bool, error) {
+	if !p.peek(kind, val) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *gqlParser) expect(kind int, val string) (gqlToken, error) {
+	t := p.token
+	if !p.peek(kind, val) {
+		expected := val
+		if expected == "" {
+			expected = "a name"
+		}
+		return t, p.errorf("expected %s, found %s", expected, t)
+	}
+	return t, p.advance()
+}
+
+func (p *gqlParser) name() (string, error) {
+	t, err := p.expect(gqlName, "")
+	return t.val, err
+}
+
+// gqlTypeRef is a type reference like [User!]!.
+type gqlTypeRef struct {
+	Name    string
+	Elem    *gqlTypeRef
+	NonNull bool
+}
+
+func (t *gqlTypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// named returns the innermost type name.
+func (t *gqlTypeRef) named() string {
+	if t.Elem != nil {
+		return t.Elem.named()
+	}
+	return t.Name
+}
+
+func (p *gqlParser) typeRef() (*gqlTypeRef, error) {
+	t := new(gqlTypeRef)
+	if ok, err := p.skip(gqlPunct, "["); err != nil {
+		return nil, err
+	} else if ok {
+		if t.Elem, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(gqlPunct, "]"); err != nil {
+			return nil, err
+		}
+	} else if t.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	var err error
+	t.NonNull, err = p.skip(gqlPunct, "!")
+	return t, err
+}
+
+// gqlVariable is a $name reference in a value.
+type gqlVariable string
+
+// value parses a value; const values may not reference variables.
+func (p *gqlParser) value(isConst bool) (interface{}, error) {
+	t := p.token
+	switch {
+	case t.kind == gqlPunct && t.val == "$" && !isConst:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case t.kind == gqlPunct && t.val == "[":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek(gqlPunct, "]") {
+			v, err := p.value(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case t.kind == gqlPunct && t.val == "{":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		for !p.peek(gqlPunct, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(gqlPunct, ":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(isConst); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	case t.kind == gqlInt:
+		n, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid int %s", t.val)
+		}
+		return n, p.advance()
+	case t.kind == gqlFloat:
+		f, _ := strconv.ParseFloat(t.val, 64)
+		return f, p.advance()
+	case t.kind == gqlString:
+		return t.val, p.advance()
+	case t.kind == gqlName:
+		var v interface{} = t.val
+		switch t.val {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		}
+		return v, p.advance()
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
+
+// arguments parses (name: value ...) if present.
+func (p *gqlParser) arguments(isConst bool) (map[string]interface{}, error) {
+	if ok, err := p.skip(gqlPunct, "("); err != nil || !ok {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for !p.peek(gqlPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(gqlPunct, ":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(isConst); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+type gqlDirective struct {
+	Name string
+	Args map[string]interface{}
+}
+
+func (p *gqlParser) directives(isConst bool) ([]*gqlDirective, error) {
+	var directives []*gqlDirective
+	for p.peek(gqlPunct, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		d := new(gqlDirective)
+		var err error
+		if d.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if d.Args, err = p.arguments(isConst); err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// description skips an optional description string.
+func (p *gqlParser) description() error {
+	_, err := p.skip(gqlString, "")
+	return err
+}
+
+// GraphQL type kinds.
+const (
+	gqlScalarKind    = "SCALAR"
+	gqlObjectKind    = "OBJECT"
+	gqlInterfaceKind = "INTERFACE"
+	gqlUnionKind     = "UNION"
+	gqlEnumKind      = "ENUM"
+	gqlInputKind     = "INPUT_OBJECT"
+)
+
+type gqlField struct {
+	Name string
+	Args map[string]*gqlTypeRef
+	Type *gqlTypeRef
+	line int
+	col  int
+}
+
+type gqlType struct {
+	Name       string
+	Kind       string
+	Fields     map[string]*gqlField
+	Interfaces []string
+	// Members of unions, implementations of interfaces
+	Possible []string
+	Values   []string
+}
+
+// GraphQLSchema is a schema parsed from SDL, queries are resolved with generated data.
+type GraphQLSchema struct {
+	types    map[string]*gqlType
+	query    string
+	mutation string
+}
+
+var gqlBuiltinScalars = []string{"Int", "Float", "String", "Boolean", "ID"}
+
+// ParseGraphQLSchema parses a schema in the GraphQL SDL. Errors are *TemplateError
+// with the line and column of the problem.
+func ParseGraphQLSchema(sdl string) (*GraphQLSchema, error) {
+	s := &GraphQLSchema{types: make(map[string]*gqlType)}
+	for _, name := range gqlBuiltinScalars {
+		s.types[name] = &gqlType{Name: name, Kind: gqlScalarKind}
+	}
+	p, err := newGqlParser(sdl)
+	if err != nil {
+		return nil, err
+	}
+	for !p.peek(gqlEOF, "") {
+		if err := s.definition(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.query == "" {
+		s.query = "Query"
+	}
+	if s.mutation == "" && s.types["Mutation"] != nil {
+		s.mutation = "Mutation"
+	}
+	if s.types[s.query] == nil || s.types[s.query].Kind != gqlObjectKind {
+		return nil, &TemplateError{Message: fmt.Sprintf("query type %s is not defined", s.query)}
+	}
+	return s, s.check()
+}
+
+func (s *GraphQLSchema) definition(p *gqlParser) error {
+	if err := p.description(); err != nil {
+		return err
+	}
+	keyword, err := p.name()
+	if err != nil {
+		return err
+	}
+	extend := keyword == "extend"
+	if extend {
+		if keyword, err = p.name(); err != nil {
+			return err
+		}
+	}
+
+	switch keyword {
+	case "schema":
+		if _, err := p.directives(true); err != nil {
+			return err
+		}
+		if _, err := p.expect(gqlPunct, "{"); err != nil {
+			return err
+		}
+		for !p.peek(gqlPunct, "}") {
+			operation, err := p.name()
+			if err != nil {
+				return err
+			}
+			if _, err := p.expect(gqlPunct, ":"); err != nil {
+				return err
+			}
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			switch operation {
+			case "query":
+				s.query = name
+			case "mutation":
+				s.mutation = name
+			}
+		}
+		return p.advance()
+	case "directive":
+		// directive @name(args) repeatable on LOCATION | ...
+		if _, err := p.expect(gqlPunct, "@"); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.argumentDefinitions(); err != nil {
+			return err
+		}
+		for !p.peek(gqlName, "on") {
+			if _, err := p.name(); err != nil {
+				return err
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.skip(gqlPunct, "|"); err != nil {
+			return err
+		}
+		for {
+			if _, err := p.name(); err != nil {
+				return err
+			}
+			if ok, err := p.skip(gqlPunct, "|"); err != nil || !ok {
+				return err
+			}
+		}
+	}
+
+	kinds := map[string]string{
+		"scalar": gqlScalarKind, "type": gqlObjectKind, "interface": gqlInterfaceKind,
+		"union": gqlUnionKind, "enum": gqlEnumKind, "input": gqlInputKind,
+	}
+	kind, ok := kinds[keyword]
+	if !ok {
+		return p.lexer.errorf(p.token.line, p.token.column, "unexpected %q", keyword)
+	}
+	line, column := p.token.line, p.token.column
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	t := s.types[name]
+	if t == nil {
+		if extend {
+			return p.lexer.errorf(line, column, "cannot extend undefined type %s", name)
+		}
+		t = &gqlType{Name: name, Kind: kind, Fields: make(map[string]*gqlField)}
+		s.types[name] = t
+	} else if !extend || t.Kind != kind {
+		return p.lexer.errorf(line, column, "type %s is already defined", name)
+	}
+
+	if ok, err := p.skip(gqlName, "implements"); err != nil {
+		return err
+	} else if ok {
+		if _, err := p.skip(gqlPunct, "&"); err != nil {
+			return err
+		}
+		for p.peek(gqlName, "") {
+			t.Interfaces = append(t.Interfaces, p.token.val)
+			if err := p.advance(); err != nil {
+				return err
+			}
+			if _, err := p.skip(gqlPunct, "&"); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := p.directives(true); err != nil {
+		return err
+	}
+
+	switch kind {
+	case gqlUnionKind:
+		if ok, err := p.skip(gqlPunct, "="); err != nil || !ok {
+			return err
+		}
+		if _, err := p.skip(gqlPunct, "|"); err != nil {
+			return err
+		}
+		for {
+			member, err := p.name()
+			if err != nil {
+				return err
+			}
+			t.Possible = append(t.Possible, member)
+			if ok, err := p.skip(gqlPunct, "|"); err != nil || !ok {
+				return err
+			}
+		}
+	case gqlEnumKind:
+		if ok, err := p.skip(gqlPunct, "{"); err != nil || !ok {
+			return err
+		}
+		for !p.peek(gqlPunct, "}") {
+			if err := p.description(); err != nil {
+				return err
+			}
+			value, err := p.name()
+			if err != nil {
+				return err
+			}
+			t.Values = append(t.Values, value)
+			if _, err := p.directives(true); err != nil {
+				return err
+			}
+		}
+		return p.advance()
+	case gqlObjectKind, gqlInterfaceKind, gqlInputKind:
+		if ok, err := p.skip(gqlPunct, "{"); err != nil || !ok {
+			return err
+		}
+		for !p.peek(gqlPunct, "}") {
+			if err := p.description(); err != nil {
+				return err
+			}
+			f := &gqlField{line: p.token.line, col: p.token.column}
+			if f.Name, err = p.name(); err != nil {
+				return err
+			}
+			if f.Args, err = p.argumentDefinitions(); err != nil {
+				return err
+			}
+			if _, err := p.expect(gqlPunct, ":"); err != nil {
+				return err
+			}
+			if f.Type, err = p.typeRef(); err != nil {
+				return err
+			}
+			if kind == gqlInputKind {
+				if ok, err := p.skip(gqlPunct, "="); err != nil {
+					return err
+				} else if ok {
+					if _, err := p.value(true); err != nil {
+						return err
+					}
+				}
+			}
+			if _, err := p.directives(true); err != nil {
+				return err
+			}
+			t.Fields[f.Name] = f
+		}
+		return p.advance()
+	}
+	return nil
+}
+
+// argumentDefinitions parses (name: Type = default ...) if present.
+func (p *gqlParser) argumentDefinitions() (map[string]*gqlTypeRef, error) {
+	if ok, err := p.skip(gqlPunct, "("); err != nil || !ok {
+		return nil, err
+	}
+	args := map[string]*gqlTypeRef{}
+	for !p.peek(gqlPunct, ")") {
+		if err := p.description(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(gqlPunct, ":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip(gqlPunct, "="); err != nil {
+			return nil, err
+		} else if ok {
+			if _, err := p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.directives(true); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+// check resolves type references and collects implementations of interfaces.
+func (s *GraphQLSchema) check() error {
+	for _, t := range s.types {
+		for _, f := range t.Fields {
+			if s.types[f.Type.named()] == nil {
+				return &TemplateError{Line: f.line, Column: f.col,
+					Message: fmt.Sprintf("%s.%s: unknown type %s", t.Name, f.Name, f.Type.named())}
+			}
+		}
+		for _, member := range t.Possible {
+			if m := s.types[member]; m == nil || m.Kind != gqlObjectKind {
+				return &TemplateError{Message: fmt.Sprintf("union %s: %s is not an object type", t.Name, member)}
+			}
+		}
+		for _, name := range t.Interfaces {
+			i := s.types[name]
+			if i == nil || i.Kind != gqlInterfaceKind {
+				return &TemplateError{Message: fmt.Sprintf("%s implements %s which is not an interface", t.Name, name)}
+			}
+		}
+	}
+	// implementations in name order keep generated data deterministic
+	for _, name := range sortedTypeNames(s.types) {
+		for _, i := range s.types[name].Interfaces {
+			s.types[i].Possible = append(s.types[i].Possible, name)
+		}
+	}
+	for _, t := range s.types {
+		if t.Kind == gqlInterfaceKind && len(t.Possible) == 0 {
+			return &TemplateError{Message: fmt.Sprintf("interface %s has no implementations", t.Name)}
+		}
+	}
+	return nil
+}
+
+func sortedTypeNames(types map[string]*gqlType) []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gqlSelection is a field, a fragment spread (Fragment is set) or an inline fragment
+// (inline is set, On may be empty).
+type gqlSelection struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Directives []*gqlDirective
+	Selections []*gqlSelection
+	Fragment   string
+	On         string
+	inline     bool
+	line       int
+	column     int
+}
+
+type gqlVarDef struct {
+	Name    string
+	Type    *gqlTypeRef
+	Default interface{}
+}
+
+type gqlOperation struct {
+	Kind       string
+	Name       string
+	Vars       []*gqlVarDef
+	Selections []*gqlSelection
+}
+
+type gqlFragment struct {
+	On         string
+	Selections []*gqlSelection
+}
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// parseGqlQuery parses an executable document: operations and fragments.
+func parseGqlQuery(src string) (*gqlDocument, error) {
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	p, err := newGqlParser(src)
+	if err != nil {
+		return nil, err
+	}
+	for !p.peek(gqlEOF, "") {
+		if p.peek(gqlPunct, "{") {
+			// query shorthand
+			op := &gqlOperation{Kind: "query"}
+			if op.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+			continue
+		}
+
+		keyword, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "fragment":
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(gqlName, "on"); err != nil {
+				return nil, err
+			}
+			frag := new(gqlFragment)
+			if frag.On, err = p.name(); err != nil {
+				return nil, err
+			}
+			if _, err := p.directives(false); err != nil {
+				return nil, err
+			}
+			if frag.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.fragments[name] = frag
+		case "query", "mutation", "subscription":
+			op := &gqlOperation{Kind: keyword}
+			if p.peek(gqlName, "") {
+				op.Name = p.token.val
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+			if op.Vars, err = p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+			if _, err := p.directives(false); err != nil {
+				return nil, err
+			}
+			if op.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.lexer.errorf(p.token.line, p.token.column, "unexpected %q", keyword)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &TemplateError{Message: "no operations"}
+	}
+	names := make([]string, 0, len(doc.fragments))
+	for name := range doc.fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checked := make(map[string]bool, len(names))
+	for _, name := range names {
+		if err := doc.checkSpreads(doc.fragments[name].Selections, map[string]bool{name: true}, checked); err != nil {
+			return nil, err
+		}
+		checked[name] = true
+	}
+	return doc, nil
+}
+
+// checkSpreads rejects fragment spreads of selections cycling back to a fragment of
+// path; checked fragments are known to have no cycles.
+func (doc *gqlDocument) checkSpreads(selections []*gqlSelection, path, checked map[string]bool) error {
+	for _, sel := range selections {
+		if sel.Fragment == "" {
+			if err := doc.checkSpreads(sel.Selections, path, checked); err != nil {
+				return err
+			}
+			continue
+		}
+		if path[sel.Fragment] {
+			return &TemplateError{Line: sel.line, Column: sel.column, Message: fmt.Sprintf("Cannot spread fragment %q within itself.", sel.Fragment)}
+		}
+		if frag := doc.fragments[sel.Fragment]; frag != nil && !checked[sel.Fragment] {
+			path[sel.Fragment] = true
+			err := doc.checkSpreads(frag.Selections, path, checked)
+			delete(path, sel.Fragment)
+			if err != nil {
+				return err
+			}
+			checked[sel.Fragment] = true
+		}
+	}
+	return nil
+}
+
+func (p *gqlParser) variableDefinitions() ([]*gqlVarDef, error) {
+	if ok, err := p.skip(gqlPunct, "("); err != nil || !ok {
+		return nil, err
+	}
+	var defs []*gqlVarDef
+	for !p.peek(gqlPunct, ")") {
+		if _, err := p.expect(gqlPunct, "$"); err != nil {
+			return nil, err
+		}
+		def := new(gqlVarDef)
+		var err error
+		if def.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(gqlPunct, ":"); err != nil {
+			return nil, err
+		}
+		if def.Type, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip(gqlPunct, "="); err != nil {
+			return nil, err
+		} else if ok {
+			if def.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.directives(true); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if _, err := p.expect(gqlPunct, "{"); err != nil {
+		return nil, err
+	}
+	var selections []*gqlSelection
+	for !p.peek(gqlPunct, "}") {
+		sel := &gqlSelection{line: p.token.line, column: p.token.column}
+		var err error
+		if ok, err := p.skip(gqlPunct, "..."); err != nil {
+			return nil, err
+		} else if ok {
+			if p.peek(gqlName, "") && p.token.val != "on" {
+				sel.Fragment = p.token.val
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if sel.Directives, err = p.directives(false); err != nil {
+					return nil, err
+				}
+			} else {
+				sel.inline = true
+				if ok, err := p.skip(gqlName, "on"); err != nil {
+					return nil, err
+				} else if ok {
+					if sel.On, err = p.name(); err != nil {
+						return nil, err
+					}
+				}
+				if sel.Directives, err = p.directives(false); err != nil {
+					return nil, err
+				}
+				if sel.Selections, err = p.selectionSet(); err != nil {
+					return nil, err
+				}
+			}
+			selections = append(selections, sel)
+			continue
+		}
+
+		if sel.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip(gqlPunct, ":"); err != nil {
+			return nil, err
+		} else if ok {
+			sel.Alias = sel.Name
+			if sel.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.Args, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		if sel.Directives, err = p.directives(false); err != nil {
+			return nil, err
+		}
+		if p.peek(gqlPunct, "{") {
+			if sel.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		selections = append(selections, sel)
+	}
+	return selections, p.advance()
+}
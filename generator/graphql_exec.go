@@ -0,0 +1,389 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// gqlListSizeArgs are arguments taken as the size of list fields.
+var gqlListSizeArgs = []string{"first", "last", "limit", "count", "size", "take", "pageSize", "perPage"}
+
+// maxGqlListSize caps list sizes requested by arguments.
+const maxGqlListSize = 100
+
+// Limits of a response, so recursive types and large lists can't exhaust the server.
+const (
+	maxGqlDepth  = 15
+	maxGqlValues = 10000
+)
+
+// gqlScalarFormats maps custom scalars, by lowercase name, to JSON Schema formats.
+var gqlScalarFormats = map[string]string{
+	"datetime":  "date-time",
+	"timestamp": "date-time",
+	"time":      "date-time",
+	"date":      "date",
+	"email":     "email",
+	"url":       "uri",
+	"uri":       "uri",
+	"uuid":      "uuid",
+	"ipv4":      "ipv4",
+	"ipv6":      "ipv6",
+}
+
+// GraphQLRequest is a request as sent by GraphQL clients.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+}
+
+// GraphQLResponse has either the data or the errors of a request.
+type GraphQLResponse struct {
+	Data   interface{}     `json:"data,omitempty"`
+	Errors []*GraphQLError `json:"errors,omitempty"`
+}
+
+func newGraphQLError(err error) *GraphQLError {
+	e := &GraphQLError{Message: err.Error()}
+	if terr, ok := err.(*TemplateError); ok {
+		e.Message = terr.Message
+		if terr.Line > 0 {
+			e.Locations = []GraphQLLocation{{Line: terr.Line, Column: terr.Column}}
+		}
+	}
+	return e
+}
+
+// Execute resolves the request with data generated from hash: fields are resolved
+// by their type and name like JSON Schema properties, so `email: String` is an email.
+// List fields have as many items as a first, limit, count... argument asks, and
+// arguments are echoed in scalar fields of the same name.
+func (s *GraphQLSchema) Execute(req *GraphQLRequest, hash string, collection *RandomDataCollection) *GraphQLResponse {
+	doc, err := parseGqlQuery(req.Query)
+	if err != nil {
+		return &GraphQLResponse{Errors: []*GraphQLError{newGraphQLError(err)}}
+	}
+	data, err := s.execute(doc, req, hash, collection)
+	if err != nil {
+		return &GraphQLResponse{Errors: []*GraphQLError{newGraphQLError(err)}}
+	}
+	return &GraphQLResponse{Data: data}
+}
+
+func (s *GraphQLSchema) execute(doc *gqlDocument, req *GraphQLRequest, hash string, collection *RandomDataCollection) (interface{}, error) {
+	var op *gqlOperation
+	for _, candidate := range doc.operations {
+		if req.OperationName == "" && len(doc.operations) == 1 || candidate.Name == req.OperationName {
+			op = candidate
+			break
+		}
+	}
+	if op == nil {
+		if req.OperationName == "" {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		return nil, fmt.Errorf("unknown operation %q", req.OperationName)
+	}
+
+	root := s.query
+	switch op.Kind {
+	case "mutation":
+		if s.mutation == "" {
+			return nil, fmt.Errorf("schema does not support mutations")
+		}
+		root = s.mutation
+	case "subscription":
+		return nil, fmt.Errorf("subscriptions are not supported")
+	}
+
+	e := &gqlExecutor{
+		schema: s,
+		doc:    doc,
+		vars:   make(map[string]interface{}, len(op.Vars)),
+		g:      newSchemaGenerator(nil, hash, collection),
+	}
+	for _, def := range op.Vars {
+		v, ok := req.Variables[def.Name]
+		if !ok {
+			v = def.Default
+		}
+		if v == nil && def.Type.NonNull {
+			return nil, fmt.Errorf("variable $%s of type %s is required", def.Name, def.Type)
+		}
+		e.vars[def.Name] = v
+	}
+	return e.object(s.types[root], op.Selections, nil)
+}
+
+type gqlExecutor struct {
+	schema *GraphQLSchema
+	doc    *gqlDocument
+	vars   map[string]interface{}
+	g      *schemaGenerator
+	// depth is the number of objects around the resolved field, values the number of resolved values
+	depth  int
+	values int
+}
+
+func (e *gqlExecutor) errorf(sel *gqlSelection, format string, args ...interface{}) *TemplateError {
+	return &TemplateError{Line: sel.line, Column: sel.column, Message: fmt.Sprintf(format, args...)}
+}
+
+// gqlFieldGroup is the selections of one response key.
+type gqlFieldGroup struct {
+	key        string
+	selections []*gqlSelection
+}
+
+// collect flattens fragments of selections applying to t into field groups in order.
+func (e *gqlExecutor) collect(t *gqlType, selections []*gqlSelection, groups []*gqlFieldGroup, visited map[string]bool) ([]*gqlFieldGroup, error) {
+	for _, sel := range selections {
+		if skip, err := e.skipped(sel); err != nil {
+			return nil, err
+		} else if skip {
+			continue
+		}
+
+		var err error
+		switch {
+		case sel.Fragment != "":
+			frag := e.doc.fragments[sel.Fragment]
+			if frag == nil {
+				return nil, e.errorf(sel, "unknown fragment %q", sel.Fragment)
+			}
+			if visited[sel.Fragment] || !e.applies(t, frag.On) {
+				continue
+			}
+			visited[sel.Fragment] = true
+			groups, err = e.collect(t, frag.Selections, groups, visited)
+		case sel.inline:
+			if sel.On == "" || e.applies(t, sel.On) {
+				groups, err = e.collect(t, sel.Selections, groups, visited)
+			}
+		default:
+			key := sel.Name
+			if sel.Alias != "" {
+				key = sel.Alias
+			}
+			found := false
+			for _, group := range groups {
+				if group.key == key {
+					group.selections = append(group.selections, sel)
+					found = true
+				}
+			}
+			if !found {
+				groups = append(groups, &gqlFieldGroup{key: key, selections: []*gqlSelection{sel}})
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// applies reports whether a fragment on the type condition applies to t.
+func (e *gqlExecutor) applies(t *gqlType, condition string) bool {
+	if condition == t.Name {
+		return true
+	}
+	if c := e.schema.types[condition]; c != nil {
+		for _, name := range c.Possible {
+			if name == t.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipped evaluates @skip and @include of the selection.
+func (e *gqlExecutor) skipped(sel *gqlSelection) (bool, error) {
+	for _, d := range sel.Directives {
+		if d.Name != "skip" && d.Name != "include" {
+			continue
+		}
+		cond, ok := e.resolveValue(d.Args["if"]).(bool)
+		if !ok {
+			return false, e.errorf(sel, "@%s requires a Boolean if argument", d.Name)
+		}
+		if cond == (d.Name == "skip") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// resolveValue replaces variables of an argument value.
+func (e *gqlExecutor) resolveValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case gqlVariable:
+		return e.vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.resolveValue(item)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			obj[name] = e.resolveValue(item)
+		}
+		return obj
+	}
+	return v
+}
+
+// object resolves selections on an object type; echo are arguments of the field
+// returning it, echoed in scalar fields of the same name.
+func (e *gqlExecutor) object(t *gqlType, selections []*gqlSelection, echo map[string]interface{}) (interface{}, error) {
+	groups, err := e.collect(t, selections, nil, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	obj := &orderedObject{values: make(map[string]interface{}, len(groups))}
+	for _, group := range groups {
+		sel := group.selections[0]
+		var v interface{}
+		if sel.Name == "__typename" {
+			v = t.Name
+		} else {
+			f := t.Fields[sel.Name]
+			if f == nil {
+				return nil, e.errorf(sel, "Cannot query field %q on type %q.", sel.Name, t.Name)
+			}
+			args := make(map[string]interface{}, len(sel.Args))
+			for name, arg := range sel.Args {
+				if _, ok := f.Args[name]; !ok {
+					return nil, e.errorf(sel, "Unknown argument %q on field \"%s.%s\".", name, t.Name, f.Name)
+				}
+				args[name] = e.resolveValue(arg)
+			}
+			var subselections []*gqlSelection
+			for _, s := range group.selections {
+				subselections = append(subselections, s.Selections...)
+			}
+			if v, err = e.field(sel, f.Type, args, subselections, echo); err != nil {
+				return nil, err
+			}
+		}
+		obj.names = append(obj.names, group.key)
+		obj.values[group.key] = v
+	}
+	return obj, nil
+}
+
+// field resolves a value of the field type.
+func (e *gqlExecutor) field(sel *gqlSelection, ref *gqlTypeRef, args map[string]interface{}, selections []*gqlSelection, echo map[string]interface{}) (interface{}, error) {
+	if e.values++; e.values > maxGqlValues {
+		return nil, e.errorf(sel, "Query resolves more than %d values.", maxGqlValues)
+	}
+	if ref.Elem != nil {
+		n := e.listSize(args)
+		list := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			// items differ, arguments are not echoed
+			item, err := e.field(sel, ref.Elem, args, selections, nil)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	}
+
+	t := e.schema.types[ref.Name]
+	switch t.Kind {
+	case gqlScalarKind, gqlEnumKind:
+		if len(selections) > 0 {
+			return nil, e.errorf(sel, "Field %q must not have a selection since type %q has no subfields.", sel.Name, t.Name)
+		}
+		if v, ok := echo[sel.Name]; ok {
+			if _, isObject := v.(map[string]interface{}); !isObject {
+				if n, isInt := v.(int64); isInt && (t.Name == "ID" || t.Name == "String") {
+					return fmt.Sprint(n), nil
+				}
+				return v, nil
+			}
+		}
+		if t.Kind == gqlEnumKind {
+			if len(t.Values) == 0 {
+				return nil, nil
+			}
+			return t.Values[e.g.r.Intn(len(t.Values))], nil
+		}
+		return e.g.generate(e.scalarSchema(t), sel.Name, 0)
+	case gqlObjectKind, gqlInterfaceKind, gqlUnionKind:
+		if len(selections) == 0 {
+			return nil, e.errorf(sel, "Field %q of type %q must have a selection of subfields.", sel.Name, ref)
+		}
+		if t.Kind != gqlObjectKind {
+			t = e.schema.types[t.Possible[e.g.r.Intn(len(t.Possible))]]
+		}
+		if e.depth == maxGqlDepth {
+			return nil, e.errorf(sel, "Query is nested deeper than %d levels.", maxGqlDepth)
+		}
+		e.depth++
+		obj, err := e.object(t, selections, args)
+		e.depth--
+		return obj, err
+	}
+	return nil, e.errorf(sel, "Field %q has the input type %q.", sel.Name, t.Name)
+}
+
+// scalarSchema is the JSON Schema generating values of the scalar.
+func (e *gqlExecutor) scalarSchema(t *gqlType) *Schema {
+	switch t.Name {
+	case "Int":
+		return &Schema{Type: schemaType{"integer"}}
+	case "Float":
+		return &Schema{Type: schemaType{"number"}}
+	case "Boolean":
+		return &Schema{Type: schemaType{"boolean"}}
+	case "ID":
+		return &Schema{Type: schemaType{"string"}, Format: "uuid"}
+	}
+	return &Schema{Type: schemaType{"string"}, Format: gqlScalarFormats[strings.ToLower(t.Name)]}
+}
+
+// listSize returns the size asked by arguments, or a random one.
+func (e *gqlExecutor) listSize(args map[string]interface{}) int {
+	for _, name := range gqlListSizeArgs {
+		var n int
+		switch v := args[name].(type) {
+		case int64:
+			n = int(v)
+		case float64:
+			n = int(v)
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				continue
+			}
+			n = int(i)
+		default:
+			continue
+		}
+		if n < 0 {
+			n = 0
+		} else if n > maxGqlListSize {
+			n = maxGqlListSize
+		}
+		return n
+	}
+	return 1 + e.g.r.Intn(defaultMaxItems)
+}
@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var testGraphQLSchema = `
+"""Users and their posts"""
+type Query {
+    user(id: ID!): User
+    users(first: Int = 10): [User!]!
+    search(text: String): [SearchResult]
+}
+
+type Mutation {
+    createPost(title: String!): Post
+}
+
+interface Node {
+    id: ID!
+}
+
+type User implements Node {
+    id: ID!
+    firstName: String
+    age: Int
+    role: Role
+    posts(limit: Int): [Post]
+}
+
+type Post implements Node {
+    id: ID!
+    title: String
+    created: DateTime
+}
+
+union SearchResult = User | Post
+
+enum Role { ADMIN USER }
+
+scalar DateTime
+`
+
+func executeGraphQL(t *testing.T, schema *GraphQLSchema, req *GraphQLRequest, collection *RandomDataCollection) string {
+	out, err := json.Marshal(schema.Execute(req, "1", collection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	collection := initTestCollection(t)
+	schema, err := ParseGraphQLSchema(testGraphQLSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &GraphQLRequest{
+		Query: `query Users($n: Int) {
+            user(id: 42) { id ...names role }
+            users(first: $n) { id, age, posts(limit: 2) { title } }
+            search { __typename ... on Post { created } }
+        }
+        fragment names on User { name: firstName }`,
+		Variables: map[string]interface{}{"n": 3.0},
+	}
+	out := executeGraphQL(t, schema, req, collection)
+	var resp struct {
+		Data struct {
+			User struct {
+				Id   string
+				Name string
+				Role string
+			}
+			Users []struct {
+				Id    string
+				Age   *int
+				Posts []struct{ Title string }
+			}
+			Search []map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.HasPrefix(out, `{"data":{"user":{"id":"42","name":`) {
+		t.Errorf("argument id expected to be echoed in order: %s", out)
+	}
+	if user := resp.Data.User; user.Name == "" || user.Role != "ADMIN" && user.Role != "USER" {
+		t.Errorf("user: unexpected %+v", user)
+	}
+	if len(resp.Data.Users) != 3 {
+		t.Fatalf("users: 3 expected; actual %d", len(resp.Data.Users))
+	}
+	for _, user := range resp.Data.Users {
+		if user.Id == "" || user.Age == nil || len(user.Posts) != 2 {
+			t.Errorf("users: unexpected %+v", user)
+		}
+	}
+	for _, result := range resp.Data.Search {
+		_, hasCreated := result["created"]
+		if typename := result["__typename"]; typename == "Post" != hasCreated || typename != "Post" && typename != "User" {
+			t.Errorf("search: unexpected %v", result)
+		}
+	}
+	if again := executeGraphQL(t, schema, req, collection); again != out {
+		t.Errorf("results of the same hash differ:\n%s\n%s", out, again)
+	}
+
+	out = executeGraphQL(t, schema, &GraphQLRequest{Query: `mutation { createPost(title: "Hi") { title } }`}, collection)
+	if out != `{"data":{"createPost":{"title":"Hi"}}}` {
+		t.Errorf("mutation: unexpected %s", out)
+	}
+}
+
+func TestExecuteGraphQLError(t *testing.T) {
+	collection := initTestCollection(t)
+	schema, err := ParseGraphQLSchema(testGraphQLSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, expected := range map[string]string{
+		"{ user(id: 1) { email } }":     `{"errors":[{"message":"Cannot query field \"email\" on type \"User\".","locations":[{"line":1,"column":17}]}]}`,
+		"{ user(id: 1) }":               `{"errors":[{"message":"Field \"user\" of type \"User\" must have a selection of subfields.","locations":[{"line":1,"column":3}]}]}`,
+		"{ users { id { x } } }":        `{"errors":[{"message":"Field \"id\" must not have a selection since type \"ID\" has no subfields.","locations":[{"line":1,"column":11}]}]}`,
+		"{ users(count: 1) { id } }":    `{"errors":[{"message":"Unknown argument \"count\" on field \"Query.users\".","locations":[{"line":1,"column":3}]}]}`,
+		"{ users {":                     `{"errors":[{"message":"expected a name, found \u003cEOF\u003e","locations":[{"line":1,"column":10}]}]}`,
+		"subscription { users { id } }": `{"errors":[{"message":"subscriptions are not supported"}]}`,
+		"{ user(id: 1) { ...F } } fragment F on User { ...G } fragment G on User { id ...F }": `{"errors":[{"message":"Cannot spread fragment \"F\" within itself.","locations":[{"line":1,"column":78}]}]}`,
+	} {
+		if out := executeGraphQL(t, schema, &GraphQLRequest{Query: query}, collection); out != expected {
+			t.Errorf("%s: expected %s; actual %s", query, expected, out)
+		}
+	}
+}
+
+func TestExecuteGraphQLLimits(t *testing.T) {
+	collection := initTestCollection(t)
+	schema, err := ParseGraphQLSchema(`type Query { a: A } type A { id: ID b(first: Int): [A!]! }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := "{ a " + strings.Repeat("{ b ", 19) + "{ id }" + strings.Repeat(" }", 20)
+	wide := "{ a " + strings.Repeat("{ b(first: 100) ", 4) + "{ id }" + strings.Repeat(" }", 5)
+	for query, expected := range map[string]string{
+		deep: fmt.Sprintf("Query is nested deeper than %d levels.", maxGqlDepth),
+		wide: fmt.Sprintf("Query resolves more than %d values.", maxGqlValues),
+	} {
+		resp := schema.Execute(&GraphQLRequest{Query: query}, "hash", collection)
+		if len(resp.Errors) != 1 || resp.Errors[0].Message != expected || resp.Data != nil {
+			t.Errorf("%s: error %q expected; actual %+v", query, expected, resp)
+		}
+	}
+}
+
+func TestParseGraphQLSchemaError(t *testing.T) {
+	for sdl, expected := range map[string]string{
+		"type Query { user: User }":                    "line 1, column 14: Query.user: unknown type User",
+		"type Query { a: Int }\ntype Query { b: Int }": "line 2, column 6: type Query is already defined",
+		"type Foo { a: Int }":                          "query type Query is not defined",
+		"type Query { a: Int":                          "line 1, column 20: expected a name, found <EOF>",
+	} {
+		_, err := ParseGraphQLSchema(sdl)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: error expected %q; actual %v", sdl, expected, err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var literalReplacer = strings.NewReplacer(
+	"{{", `{{ "{{" }}`,
+	"{%", `{{ "{%" }}`,
+	"{#", `{{ "{#" }}`,
+)
+
+// Literal returns a template rendering s as is.
+func Literal(s string) string {
+	return literalReplacer.Replace(s)
+}
+
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[a-zA-Z]{2,}$`)
+
+// valueIndex maps known values of the collection to the functions generating them.
+type valueIndex map[string]string
+
+func newValueIndex(collection *RandomDataCollection) valueIndex {
+	index := make(valueIndex)
+	add := func(function string, values ...string) {
+		for _, v := range values {
+			if _, ok := index[v]; !ok && v != "" {
+				index[v] = function
+			}
+		}
+	}
+	// the first function wins, e.g. GB is a country code rather than something else
+	for _, c := range collection.countries {
+		add("FullCountry", c.Name.Official, c.Name.Common)
+	}
+	for _, c := range collection.countries {
+		add("ThreeLetterCountry", c.CountryCode3)
+		add("TwoLetterCountry", c.CountryCode2)
+	}
+	for _, c := range collection.countries {
+		add("City", c.Capital)
+	}
+	for _, s := range collection.states {
+		add("StateUsaName", s.State)
+	}
+	add("FirstName", collection.femaleNames...)
+	add("FirstName", collection.maleNames...)
+	add("LastName", collection.lastNames...)
+	return index
+}
+
+// function returns the function generating values like s or an empty string.
+func (index valueIndex) function(s string) string {
+	if emailRegexp.MatchString(s) {
+		return "Email"
+	}
+	if ip := net.ParseIP(s); ip != nil && ip.To4() != nil && strings.Contains(s, ".") {
+		return "IPv4"
+	}
+	if function, ok := index[s]; ok {
+		return function
+	}
+	if parts := strings.Split(s, " "); len(parts) == 2 && index[parts[0]] == "FirstName" && index[parts[1]] == "LastName" {
+		return "FullName"
+	}
+	return ""
+}
+
+// InferTemplate turns a captured JSON payload into a template: strings recognised
+// as names, emails, countries, cities or IPs, all numbers and booleans are replaced
+// with the matching functions, keys keep their order. Bodies which aren't JSON
+// are returned as literal templates.
+func InferTemplate(body string, collection *RandomDataCollection) string {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := inferValue(dec, &buf, newValueIndex(collection), ""); err != nil {
+		return Literal(body)
+	}
+	if _, err := dec.Token(); err == nil {
+		// more than one value
+		return Literal(body)
+	}
+	return buf.String()
+}
+
+func inferValue(dec *json.Decoder, buf *bytes.Buffer, index valueIndex, indent string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := token.(type) {
+	case json.Delim:
+		open, end := string(v), "}"
+		if v == '[' {
+			end = "]"
+		}
+		buf.WriteString(open)
+		n := 0
+		for ; dec.More(); n++ {
+			if n > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n" + indent + "  ")
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				buf.WriteString(Literal(quoteJson(key.(string))) + ": ")
+			}
+			if err := inferValue(dec, buf, index, indent+"  "); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if n > 0 {
+			buf.WriteString("\n" + indent)
+		}
+		buf.WriteString(end)
+	case string:
+		if function := index.function(v); function != "" {
+			fmt.Fprintf(buf, `"{{ %s() }}"`, function)
+		} else {
+			buf.WriteString(Literal(quoteJson(v)))
+		}
+	case json.Number:
+		buf.WriteString(inferNumber(string(v)))
+	case bool:
+		buf.WriteString("{{ BooleanString() }}")
+	default:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// inferNumber generates numbers from zero to the next power of ten with the same precision.
+// Negative, exponent and long numbers are kept as is.
+func inferNumber(s string) string {
+	if strings.HasPrefix(s, "-") || strings.ContainsAny(s, "eE") {
+		return s
+	}
+	integer, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		integer, fraction = s[:i], s[i+1:]
+	}
+	digits := len(strings.TrimLeft(integer, "0"))
+	if digits > 9 {
+		return s
+	}
+	upper := "1" + strings.Repeat("0", digits)
+	if upper == "1" {
+		upper = "10"
+	}
+	if fraction == "" {
+		return fmt.Sprintf("{{ Number(0, %s) }}", upper)
+	}
+	return fmt.Sprintf("{{ Float(0, %s, %d) }}", upper, len(fraction))
+}
+
+func quoteJson(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+var (
+	dateRegexp     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	dateTimeRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})$`)
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// InferSchema returns a schema all JSON samples conform to: properties missing
+// in some samples aren't required, formats and types are kept if all values agree.
+func InferSchema(samples []string) (*Schema, error) {
+	var schema *Schema
+	for _, sample := range samples {
+		dec := json.NewDecoder(strings.NewReader(sample))
+		dec.UseNumber()
+		s, err := inferSchemaValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dec.Token(); err == nil {
+			return nil, fmt.Errorf("more than one JSON value")
+		}
+		schema = mergeInferred(schema, s)
+	}
+	return schema, nil
+}
+
+func inferSchemaValue(dec *json.Decoder) (*Schema, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := token.(type) {
+	case json.Delim:
+		if v == '[' {
+			s := &Schema{Type: schemaType{"array"}}
+			for dec.More() {
+				item, err := inferSchemaValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				s.Items = mergeInferred(s.Items, item)
+			}
+			_, err := dec.Token()
+			return s, err
+		}
+		s := &Schema{
+			Type:       schemaType{"object"},
+			Properties: &schemaProperties{schemas: make(map[string]*Schema)},
+			Required:   []string{},
+		}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := key.(string)
+			property, err := inferSchemaValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := s.Properties.schemas[name]; !ok {
+				s.Properties.names = append(s.Properties.names, name)
+				s.Required = append(s.Required, name)
+			}
+			s.Properties.schemas[name] = property
+		}
+		_, err := dec.Token()
+		return s, err
+	case string:
+		return &Schema{Type: schemaType{"string"}, Format: inferFormat(v)}, nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return &Schema{Type: schemaType{"integer"}}, nil
+		}
+		return &Schema{Type: schemaType{"number"}}, nil
+	case bool:
+		return &Schema{Type: schemaType{"boolean"}}, nil
+	}
+	return &Schema{Nullable: true}, nil
+}
+
+func inferFormat(s string) string {
+	switch {
+	case emailRegexp.MatchString(s):
+		return "email"
+	case uuidRegexp.MatchString(s):
+		return "uuid"
+	case dateRegexp.MatchString(s):
+		return "date"
+	case dateTimeRegexp.MatchString(s):
+		return "date-time"
+	}
+	if ip := net.ParseIP(s); ip != nil && ip.To4() != nil && strings.Contains(s, ".") {
+		return "ipv4"
+	}
+	return ""
+}
+
+// mergeInferred returns a schema of values of both a and b, either may be nil.
+func mergeInferred(a, b *Schema) *Schema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	merged := &Schema{Nullable: a.Nullable || b.Nullable}
+	switch {
+	case len(a.Type) == 0 && a.Nullable:
+		// null
+		b.Nullable = true
+		return b
+	case len(b.Type) == 0 && b.Nullable:
+		a.Nullable = true
+		return a
+	case len(a.Type) == 0 || len(b.Type) == 0:
+		return &Schema{}
+	case a.Type[0] == b.Type[0]:
+		merged.Type = a.Type
+	case a.Type[0] == "number" && b.Type[0] == "integer", a.Type[0] == "integer" && b.Type[0] == "number":
+		merged.Type = schemaType{"number"}
+	default:
+		// values of different types, any value is fine
+		return &Schema{}
+	}
+	if a.Format == b.Format {
+		merged.Format = a.Format
+	}
+	merged.Items = mergeInferred(a.Items, b.Items)
+
+	if a.Properties != nil && b.Properties != nil {
+		merged.Properties = &schemaProperties{schemas: make(map[string]*Schema)}
+		for _, p := range []*schemaProperties{a.Properties, b.Properties} {
+			for _, name := range p.names {
+				if _, ok := merged.Properties.schemas[name]; !ok {
+					merged.Properties.names = append(merged.Properties.names, name)
+				}
+				merged.Properties.schemas[name] = mergeInferred(merged.Properties.schemas[name], p.schemas[name])
+			}
+		}
+		merged.Required = []string{}
+		for _, name := range a.Required {
+			if containsName(b.Required, name) {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+	}
+	return merged
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInferTemplate(t *testing.T) {
+	collection := initTestCollection(t)
+	body := `{"name": "Grace Smith", "first": "Olivia", "email": "grace@example.com", "ip": "10.0.0.1",
+		"country": "GB", "city": "London", "age": 42, "score": 9.75, "active": true,
+		"note": "{{ not a template }}", "tags": [], "nested": [{"last": "Johnson", "id": null}]}`
+	expected := `{
+  "name": "{{ FullName() }}",
+  "first": "{{ FirstName() }}",
+  "email": "{{ Email() }}",
+  "ip": "{{ IPv4() }}",
+  "country": "{{ TwoLetterCountry() }}",
+  "city": "{{ City() }}",
+  "age": {{ Number(0, 100) }},
+  "score": {{ Float(0, 10, 2) }},
+  "active": {{ BooleanString() }},
+  "note": "{{ "{{" }} not a template }}",
+  "tags": [],
+  "nested": [
+    {
+      "last": "{{ LastName() }}",
+      "id": null
+    }
+  ]
+}`
+	tpl := InferTemplate(body, collection)
+	if tpl != expected {
+		t.Fatalf("template expected\n%s\nactual\n%s", expected, tpl)
+	}
+
+	out, err := Render(tpl, "d1f4ac76-5e1c-4a8d-8e5e-0c0a0d7fbc8b", collection)
+	if err != nil {
+		t.Fatalf("Render error: %v", err)
+	}
+	var rendered map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &rendered); err != nil {
+		t.Fatalf("rendered template isn't JSON: %v\n%s", err, out)
+	}
+	if rendered["note"] != "{{ not a template }}" {
+		t.Errorf("note expected to be kept as is; actual %q", rendered["note"])
+	}
+}
+
+func TestInferTemplateNotJson(t *testing.T) {
+	collection := initTestCollection(t)
+	for _, body := range []string{"plain {% text %}", `{"a": 1} {"b": 2}`} {
+		tpl := InferTemplate(body, collection)
+		out, err := Render(tpl, "hash", collection)
+		if err != nil {
+			t.Errorf("%q: Render error: %v", body, err)
+		}
+		if out != body {
+			t.Errorf("%q: expected to be rendered as is; actual %q", body, out)
+		}
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	schema, err := InferSchema([]string{
+		`{"id": 1, "email": "a@example.com", "score": 1, "tags": ["a"], "parent": null, "created": "2017-01-02T03:04:05Z"}`,
+		`{"id": 2, "email": "b@example.com", "score": 2.5, "tags": [], "parent": {"id": 1}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"type":"object","properties":{` +
+		`"id":{"type":"integer"},` +
+		`"email":{"type":"string","format":"email"},` +
+		`"score":{"type":"number"},` +
+		`"tags":{"type":"array","items":{"type":"string"}},` +
+		`"parent":{"type":"object","properties":{"id":{"type":"integer"}},"required":["id"],"nullable":true},` +
+		`"created":{"type":"string","format":"date-time"}},` +
+		`"required":["id","email","score","tags","parent"]}`
+	if string(b) != expected {
+		t.Errorf("schema expected:\n%s\nactual:\n%s", expected, b)
+	}
+
+	if _, err := InferSchema([]string{"not json"}); err == nil {
+		t.Error("error expected for a sample which isn't JSON")
+	}
+}
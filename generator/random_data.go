@@ -1,10 +1,12 @@
 package generator
 
 import (
+	"encoding/json"
 	"fmt"
 	"hash/crc64"
 	"math"
 	"math/rand"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -37,6 +39,10 @@ type RandomData struct {
 	hash       string
 	hashInt64  int64
 	collection *RandomDataCollection
+	// deterministic functions without a key derive their values from the hash
+	// and the number of calls before them instead of the time
+	deterministic bool
+	calls         int
 }
 
 func NewRandomData(hash string, collection *RandomDataCollection) *RandomData {
@@ -48,6 +54,52 @@ func NewRandomData(hash string, collection *RandomDataCollection) *RandomData {
 	}
 }
 
+// NewDeterministicRandomData returns RandomData where every function derives its
+// value from the hash: the same calls in the same order give the same values.
+func NewDeterministicRandomData(hash string, collection *RandomDataCollection) *RandomData {
+	rd := NewRandomData(hash, collection)
+	rd.deterministic = true
+	return rd
+}
+
+// src returns the random source of a function without a key.
+func (rd *RandomData) src() int64 {
+	if !rd.deterministic {
+		return time.Now().UnixNano()
+	}
+	rd.calls++
+	// unlike hashInt64+key of *Chain functions, sources of calls don't repeat chained values
+	return stringToInt64(rd.hash + "#" + strconv.Itoa(rd.calls))
+}
+
+// keySrc returns the random source of a *Chain function key. Integers (also as
+// strings, like path parameters, or integral JSON numbers) are added to the hash,
+// other keys are hashed with it, so a key gives the same values in every template
+// rendered with the hash.
+func (rd *RandomData) keySrc(key interface{}) int64 {
+	switch k := key.(type) {
+	case string:
+		if n, err := strconv.ParseInt(k, 10, 64); err == nil && strconv.FormatInt(n, 10) == k {
+			return n + rd.hashInt64
+		}
+		return stringToInt64(rd.hash + "\x00" + k)
+	case json.Number:
+		return rd.keySrc(string(k))
+	}
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() + rd.hashInt64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()) + rd.hashInt64
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f) + rd.hashInt64
+		}
+	}
+	return stringToInt64(rd.hash + "\x00" + fmt.Sprint(key))
+}
+
 func (rd *RandomData) getFirstName(gender int, src int64) string {
 	r := rand.New(rand.NewSource(src))
 	switch gender {
@@ -69,11 +121,13 @@ func (rd *RandomData) getLastName(src int64) string {
 	return rd.collection.LastName(r)
 }
 
+// getEmail returns the email of the person with names of the same src, so
+// EmailChain(key) belongs to FullNameChain(key).
 func (rd *RandomData) getEmail(src int64) string {
 	r := rand.New(rand.NewSource(src))
 	return fmt.Sprintf("%s.%s.example@%s",
-		strings.ToLower(rd.FirstName()),
-		strings.ToLower(rd.LastName()),
+		strings.ToLower(rd.getFirstName(AnyGender, src)),
+		strings.ToLower(rd.getLastName(src)),
 		rd.collection.EmailDomain(r))
 }
 
@@ -146,49 +200,49 @@ func (rd *RandomData) getParagraph(src int64) string {
 }
 
 func (rd *RandomData) FirstName() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getFirstName(AnyGender, src)
 }
 
-func (rd *RandomData) FirstNameChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) FirstNameChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getFirstName(AnyGender, src)
 }
 
 func (rd *RandomData) FirstNameMale() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getFirstName(Male, src)
 }
 
-func (rd *RandomData) FirstNameMaleChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) FirstNameMaleChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getFirstName(Male, src)
 }
 
 func (rd *RandomData) FirstNameFemale() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getFirstName(Female, src)
 }
 
-func (rd *RandomData) FirstNameFemaleChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) FirstNameFemaleChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getFirstName(Female, src)
 }
 
 func (rd *RandomData) LastName() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getLastName(src)
 }
 
-func (rd *RandomData) LastNameChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) LastNameChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getLastName(src)
 }
 
 func (rd *RandomData) FullName() string {
 	return rd.FirstName() + " " + rd.LastName()
 }
-func (rd *RandomData) FullNameChain(key int) string {
+func (rd *RandomData) FullNameChain(key interface{}) string {
 	return rd.FirstNameChain(key) + " " + rd.LastNameChain(key)
 }
 
@@ -196,7 +250,7 @@ func (rd *RandomData) FullNameMale() string {
 	return rd.FirstNameMale() + " " + rd.LastName()
 }
 
-func (rd *RandomData) FullNameMaleChain(key int) string {
+func (rd *RandomData) FullNameMaleChain(key interface{}) string {
 	return rd.FirstNameMaleChain(key) + " " + rd.LastNameChain(key)
 }
 
@@ -204,87 +258,87 @@ func (rd *RandomData) FullNameFemale() string {
 	return rd.FirstNameFemale() + " " + rd.LastName()
 }
 
-func (rd *RandomData) FullNameFemaleChain(key int) string {
+func (rd *RandomData) FullNameFemaleChain(key interface{}) string {
 	return rd.FirstNameFemaleChain(key) + " " + rd.LastNameChain(key)
 }
 
 func (rd *RandomData) Email() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getEmail(src)
 }
 
-func (rd *RandomData) EmailChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) EmailChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getEmail(src)
 }
 
 func (rd *RandomData) City() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getCity(src)
 }
 
-func (rd *RandomData) CityChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) CityChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getCity(src)
 }
 
 func (rd *RandomData) FullCountry() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getCountry(CountryNameFormat, src)
 }
 
-func (rd *RandomData) FullCountryChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) FullCountryChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getCountry(CountryNameFormat, src)
 }
 
 func (rd *RandomData) CountryCode2() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getCountry(CountryCode2Format, src)
 }
 
-func (rd *RandomData) CountryCode2Chain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) CountryCode2Chain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getCountry(CountryCode2Format, src)
 }
 
 func (rd *RandomData) CountryCode3() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getCountry(CountryCode3Format, src)
 }
 
-func (rd *RandomData) CountryCode3Chain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) CountryCode3Chain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getCountry(CountryCode3Format, src)
 }
 
 func (rd *RandomData) StateUsaCode() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getStateUsa(StateUsaCodeFormat, src)
 }
 
-func (rd *RandomData) StateUsaCodeChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) StateUsaCodeChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getStateUsa(StateUsaCodeFormat, src)
 }
 
 func (rd *RandomData) StateUsaName() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getStateUsa(StateUsaNameFormat, src)
 }
 
-func (rd *RandomData) StateUsaNameChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) StateUsaNameChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getStateUsa(StateUsaNameFormat, src)
 }
 
 func (rd *RandomData) Boolean() bool {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getBoolean(src)
 }
 
-func (rd *RandomData) BooleanChain(key int) bool {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) BooleanChain(key interface{}) bool {
+	src := rd.keySrc(key)
 	return rd.getBoolean(src)
 }
 
@@ -295,7 +349,7 @@ func (rd *RandomData) BooleanString() string {
 	return "false"
 }
 
-func (rd *RandomData) BooleanStringChain(key int) string {
+func (rd *RandomData) BooleanStringChain(key interface{}) string {
 	if rd.BooleanChain(key) {
 		return "true"
 	}
@@ -303,12 +357,12 @@ func (rd *RandomData) BooleanStringChain(key int) string {
 }
 
 func (rd *RandomData) Number(numberRange ...int) int {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getNumber(src, numberRange...)
 }
 
-func (rd *RandomData) NumberChain(key int, numberRange ...int) int {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) NumberChain(key interface{}, numberRange ...int) int {
+	src := rd.keySrc(key)
 	return rd.getNumber(src, numberRange...)
 }
 
@@ -316,36 +370,36 @@ func (rd *RandomData) NumberString(numberRange ...int) string {
 	return strconv.Itoa(rd.Number(numberRange...))
 }
 
-func (rd *RandomData) NumberStringChain(key int, numberRange ...int) string {
+func (rd *RandomData) NumberStringChain(key interface{}, numberRange ...int) string {
 	return strconv.Itoa(rd.NumberChain(key, numberRange...))
 }
 
 func (rd *RandomData) Float(numberRange ...int) float64 {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getFloat(src, numberRange...)
 }
 
-func (rd *RandomData) FloatChain(key int, numberRange ...int) float64 {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) FloatChain(key interface{}, numberRange ...int) float64 {
+	src := rd.keySrc(key)
 	return rd.getFloat(src, numberRange...)
 }
 
 func (rd *RandomData) IPv4() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getIPv4(src)
 }
 
-func (rd *RandomData) IPv4Chain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) IPv4Chain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getIPv4(src)
 }
 
 func (rd *RandomData) Paragraph() string {
-	src := time.Now().UnixNano()
+	src := rd.src()
 	return rd.getParagraph(src)
 }
 
-func (rd *RandomData) ParagraphChain(key int) string {
-	src := int64(key) + rd.hashInt64
+func (rd *RandomData) ParagraphChain(key interface{}) string {
+	src := rd.keySrc(key)
 	return rd.getParagraph(src)
 }
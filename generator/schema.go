@@ -0,0 +1,571 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSchemaDepth limits nesting of generated documents for recursive schemas,
+	// deeper objects get required properties only and arrays get minItems items.
+	maxSchemaDepth = 8
+	// defaultMaxItems is the array length limit if maxItems isn't set.
+	defaultMaxItems = 5
+	defaultMaximum  = 1000
+	// maxSchemaBound limits minimum and maximum to integers exact in JSON numbers,
+	// so ranges of generated integers don't overflow
+	maxSchemaBound = 1 << 53
+)
+
+// schemaEpoch is the middle of generated date-time values.
+var schemaEpoch = time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Schema is the JSON Schema subset documents are generated from.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        schemaType         `json:"type,omitempty"`
+	Properties  *schemaProperties  `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Const       interface{}        `json:"const,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	OneOf       []*Schema          `json:"oneOf,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	AllOf       []*Schema          `json:"allOf,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+	// Nullable is the OpenAPI 3.0 flag set by InferSchema, generated values are never null
+	Nullable bool `json:"nullable,omitempty"`
+}
+
+// schemaType is a type name or a list of them.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaType{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = names
+	return nil
+}
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// schemaProperties keeps properties in the order of the schema.
+type schemaProperties struct {
+	names   []string
+	schemas map[string]*Schema
+}
+
+func (p *schemaProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.schemas); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			if t == '{' || t == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		case string:
+			if depth == 1 {
+				p.names = append(p.names, t)
+				// skip the property schema
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return err
+				}
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func (p *schemaProperties) MarshalJSON() ([]byte, error) {
+	obj := &orderedObject{names: p.names, values: make(map[string]interface{}, len(p.schemas))}
+	for name, schema := range p.schemas {
+		obj.values[name] = schema
+	}
+	return obj.MarshalJSON()
+}
+
+// ParseSchema parses a JSON Schema and checks its local $ref pointers resolve.
+func ParseSchema(data []byte) (*Schema, error) {
+	schema := new(Schema)
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if err := schema.check(schema, "#"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (s *Schema) check(root *Schema, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		if _, err := root.resolve(s.Ref); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for _, name := range s.Type {
+		switch name {
+		case "object", "array", "string", "integer", "number", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+	for _, b := range []struct {
+		name  string
+		bound *float64
+	}{{"minimum", s.Minimum}, {"maximum", s.Maximum}} {
+		if b.bound != nil && math.Abs(*b.bound) > maxSchemaBound {
+			return fmt.Errorf("%s: %s is out of range, at most 2^53 in absolute value", path, b.name)
+		}
+	}
+	for _, b := range []struct {
+		name  string
+		bound *int
+	}{{"minItems", s.MinItems}, {"maxItems", s.MaxItems}, {"minLength", s.MinLength}, {"maxLength", s.MaxLength}} {
+		if b.bound != nil && *b.bound < 0 {
+			return fmt.Errorf("%s: %s is negative", path, b.name)
+		}
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return fmt.Errorf("%s: minimum is greater than maximum", path)
+	}
+	if s.MinItems != nil && s.MaxItems != nil && *s.MinItems > *s.MaxItems {
+		return fmt.Errorf("%s: minItems is greater than maxItems", path)
+	}
+	if s.MinLength != nil && s.MaxLength != nil && *s.MinLength > *s.MaxLength {
+		return fmt.Errorf("%s: minLength is greater than maxLength", path)
+	}
+
+	children := map[string]*Schema{"items": s.Items}
+	if s.Properties != nil {
+		for name, child := range s.Properties.schemas {
+			children["properties/"+name] = child
+		}
+	}
+	for key, list := range map[string][]*Schema{"oneOf": s.OneOf, "anyOf": s.AnyOf, "allOf": s.AllOf} {
+		for i, child := range list {
+			children[fmt.Sprintf("%s/%d", key, i)] = child
+		}
+	}
+	for key, defs := range map[string]map[string]*Schema{"definitions": s.Definitions, "$defs": s.Defs} {
+		for name, child := range defs {
+			children[key+"/"+name] = child
+		}
+	}
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		keys = append(keys, key)
+	}
+	// in order, so the first error is always the same
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := children[key].check(root, path+"/"+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve follows a local reference like #/definitions/user or #/$defs/user.
+func (s *Schema) resolve(ref string) (*Schema, error) {
+	if ref == "#" {
+		return s, nil
+	}
+	for prefix, defs := range map[string]map[string]*Schema{"#/definitions/": s.Definitions, "#/$defs/": s.Defs} {
+		if strings.HasPrefix(ref, prefix) {
+			if def, ok := defs[strings.TrimPrefix(ref, prefix)]; ok {
+				return def, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unresolved $ref %q, only #/definitions/... and #/$defs/... are supported", ref)
+}
+
+// GenerateFromSchema generates a JSON document conforming to schema.
+// The document depends on the hash only, like values of *Chain functions.
+func GenerateFromSchema(schema *Schema, hash string, collection *RandomDataCollection) (string, error) {
+	v, err := newSchemaGenerator(schema, hash, collection).generate(schema, "", 0)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+type schemaGenerator struct {
+	root *Schema
+	rd   *RandomData
+	r    *rand.Rand
+	// key of the next *Chain call
+	key int
+}
+
+func newSchemaGenerator(root *Schema, hash string, collection *RandomDataCollection) *schemaGenerator {
+	rd := NewRandomData(hash, collection)
+	return &schemaGenerator{root: root, rd: rd, r: rand.New(rand.NewSource(rd.hashInt64))}
+}
+
+func (g *schemaGenerator) nextKey() int {
+	g.key++
+	return g.key
+}
+
+// orderedObject marshals properties in the schema order.
+type orderedObject struct {
+	names  []string
+	values map[string]interface{}
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, name := range o.names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(o.values[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// generate returns a value for s; name is the property name used to pick
+// a generator for strings without a format.
+func (g *schemaGenerator) generate(s *Schema, name string, depth int) (interface{}, error) {
+	if depth > 2*maxSchemaDepth {
+		return nil, fmt.Errorf("schema recursion is too deep")
+	}
+	if s.Ref != "" {
+		ref, err := g.root.resolve(s.Ref)
+		if err != nil {
+			return nil, err
+		}
+		return g.generate(ref, name, depth+1)
+	}
+	if s.Const != nil {
+		return s.Const, nil
+	}
+	if len(s.Enum) > 0 {
+		return s.Enum[g.r.Intn(len(s.Enum))], nil
+	}
+	if n := len(s.OneOf) + len(s.AnyOf); n > 0 {
+		alternatives := make([]*Schema, 0, n)
+		alternatives = append(append(alternatives, s.OneOf...), s.AnyOf...)
+		return g.generate(alternatives[g.r.Intn(len(alternatives))], name, depth+1)
+	}
+	if len(s.AllOf) > 0 {
+		return g.generate(mergeSchemas(s.AllOf), name, depth+1)
+	}
+
+	switch g.typeOf(s) {
+	case "object":
+		return g.object(s, depth)
+	case "array":
+		return g.array(s, name, depth)
+	case "integer":
+		low, high := g.bounds(s)
+		low, high = math.Ceil(low), math.Floor(high)
+		if low > high {
+			return nil, fmt.Errorf("no integer between minimum and maximum")
+		}
+		return int64(low) + g.r.Int63n(int64(high-low)+1), nil
+	case "number":
+		low, high := g.bounds(s)
+		// two decimals unless the range is narrower
+		v := math.Floor((low+g.r.Float64()*(high-low))*100) / 100
+		if v < low {
+			v = low
+		}
+		return v, nil
+	case "boolean":
+		return g.rd.BooleanChain(g.nextKey()), nil
+	case "null":
+		return nil, nil
+	default:
+		return g.str(s, name), nil
+	}
+}
+
+// typeOf picks one of the schema types, guessing it if there are none.
+func (g *schemaGenerator) typeOf(s *Schema) string {
+	switch {
+	case len(s.Type) > 0:
+		return s.Type[g.r.Intn(len(s.Type))]
+	case s.Properties != nil:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	case s.Minimum != nil || s.Maximum != nil:
+		return "number"
+	}
+	return "string"
+}
+
+func (g *schemaGenerator) object(s *Schema, depth int) (interface{}, error) {
+	obj := &orderedObject{values: make(map[string]interface{})}
+	if s.Properties == nil {
+		return obj, nil
+	}
+	required := make(map[string]bool, len(s.Required))
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	for _, name := range s.Properties.names {
+		if depth >= maxSchemaDepth && !required[name] {
+			continue
+		}
+		v, err := g.generate(s.Properties.schemas[name], name, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj.names = append(obj.names, name)
+		obj.values[name] = v
+	}
+	return obj, nil
+}
+
+func (g *schemaGenerator) array(s *Schema, name string, depth int) (interface{}, error) {
+	minItems, maxItems := 1, defaultMaxItems
+	if s.MinItems != nil {
+		minItems = *s.MinItems
+	}
+	if s.MaxItems != nil {
+		maxItems = *s.MaxItems
+	} else if minItems > maxItems {
+		maxItems = minItems
+	}
+	if minItems > maxItems {
+		minItems = maxItems
+	}
+	n := minItems + g.r.Intn(maxItems-minItems+1)
+	if depth >= maxSchemaDepth {
+		n = minItems
+	}
+
+	items := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		item := &Schema{}
+		if s.Items != nil {
+			item = s.Items
+		}
+		v, err := g.generate(item, strings.TrimSuffix(name, "s"), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// bounds returns minimum and maximum, 0 and defaultMaximum by default.
+func (g *schemaGenerator) bounds(s *Schema) (float64, float64) {
+	low, high := 0.0, float64(defaultMaximum)
+	if s.Minimum != nil {
+		low = *s.Minimum
+		if s.Maximum == nil && high < low {
+			high = low + defaultMaximum
+		}
+	}
+	if s.Maximum != nil {
+		high = *s.Maximum
+		if s.Minimum == nil && low > high {
+			low = high - defaultMaximum
+		}
+	}
+	return low, high
+}
+
+// str generates a string by the format, or by the property name if there is no format.
+func (g *schemaGenerator) str(s *Schema, name string) string {
+	switch s.Format {
+	case "email":
+		return g.rd.EmailChain(g.nextKey())
+	case "date-time":
+		return g.time().Format(time.RFC3339)
+	case "date":
+		return g.time().Format("2006-01-02")
+	case "ipv4":
+		return g.rd.IPv4Chain(g.nextKey())
+	case "ipv6":
+		parts := make([]string, 8)
+		for i := range parts {
+			parts[i] = fmt.Sprintf("%x", g.r.Intn(1<<16))
+		}
+		return strings.Join(parts, ":")
+	case "uuid":
+		b := make([]byte, 16)
+		g.r.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "uri":
+		return "https://example.com/" + g.word(5, 10)
+	case "hostname":
+		return g.word(5, 10) + ".example.com"
+	}
+
+	minLength, maxLength := 0, -1
+	if s.MinLength != nil {
+		minLength = *s.MinLength
+	}
+	if s.MaxLength != nil {
+		maxLength = *s.MaxLength
+	}
+	if v := g.byName(name); v != "" && len(v) >= minLength && (maxLength < 0 || len(v) <= maxLength) {
+		return v
+	}
+	if maxLength < 0 {
+		maxLength = minLength + 12
+	}
+	if minLength == 0 && maxLength > 0 {
+		minLength = 1
+	}
+	return g.word(minLength, maxLength)
+}
+
+// byName generates a value for well-known property names, e.g. first_name or firstName.
+func (g *schemaGenerator) byName(name string) string {
+	name = strings.ToLower(strings.Replace(name, "_", "", -1))
+	switch name {
+	case "firstname", "givenname":
+		return g.rd.FirstNameChain(g.nextKey())
+	case "lastname", "familyname", "surname":
+		return g.rd.LastNameChain(g.nextKey())
+	case "name", "fullname":
+		return g.rd.FullNameChain(g.nextKey())
+	case "email":
+		return g.rd.EmailChain(g.nextKey())
+	case "city":
+		return g.rd.CityChain(g.nextKey())
+	case "country":
+		return g.rd.FullCountryChain(g.nextKey())
+	case "countrycode":
+		return g.rd.CountryCode2Chain(g.nextKey())
+	case "state":
+		return g.rd.StateUsaNameChain(g.nextKey())
+	case "ip", "ipaddress":
+		return g.rd.IPv4Chain(g.nextKey())
+	case "description", "text", "bio":
+		return g.rd.ParagraphChain(g.nextKey())
+	}
+	return ""
+}
+
+func (g *schemaGenerator) word(minLength, maxLength int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, minLength+g.r.Intn(maxLength-minLength+1))
+	for i := range b {
+		b[i] = letters[g.r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// time returns a time within five years around schemaEpoch.
+func (g *schemaGenerator) time() time.Time {
+	const span = 5 * 365 * 24 * time.Hour
+	return schemaEpoch.Add(time.Duration(g.r.Int63n(int64(2*span))) - span).Truncate(time.Second)
+}
+
+// mergeSchemas combines allOf schemas: properties and required are merged, the
+// last schema wins for other keywords.
+func mergeSchemas(schemas []*Schema) *Schema {
+	merged := &Schema{}
+	for _, s := range schemas {
+		if s.Properties != nil {
+			if merged.Properties == nil {
+				merged.Properties = &schemaProperties{schemas: make(map[string]*Schema)}
+			}
+			for _, name := range s.Properties.names {
+				if _, ok := merged.Properties.schemas[name]; !ok {
+					merged.Properties.names = append(merged.Properties.names, name)
+				}
+				merged.Properties.schemas[name] = s.Properties.schemas[name]
+			}
+		}
+		merged.Required = append(merged.Required, s.Required...)
+		for _, field := range []struct{ dst, src *string }{{&merged.Ref, &s.Ref}, {&merged.Format, &s.Format}} {
+			if *field.src != "" {
+				*field.dst = *field.src
+			}
+		}
+		if len(s.Type) > 0 {
+			merged.Type = s.Type
+		}
+		if s.Items != nil {
+			merged.Items = s.Items
+		}
+		if s.Minimum != nil {
+			merged.Minimum = s.Minimum
+		}
+		if s.Maximum != nil {
+			merged.Maximum = s.Maximum
+		}
+		if s.MinLength != nil {
+			merged.MinLength = s.MinLength
+		}
+		if s.MaxLength != nil {
+			merged.MaxLength = s.MaxLength
+		}
+		if s.MinItems != nil {
+			merged.MinItems = s.MinItems
+		}
+		if s.MaxItems != nil {
+			merged.MaxItems = s.MaxItems
+		}
+		if len(s.Enum) > 0 {
+			merged.Enum = s.Enum
+		}
+	}
+	return merged
+}
@@ -0,0 +1,152 @@
+package generator
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSchema = `{
+    "type": "object",
+    "required": ["id", "user", "tags"],
+    "properties": {
+        "id": {"type": "string", "format": "uuid"},
+        "user": {"$ref": "#/definitions/user"},
+        "tags": {"type": "array", "items": {"type": "string", "minLength": 3, "maxLength": 5}, "minItems": 2, "maxItems": 3},
+        "role": {"enum": ["admin", "user"]},
+        "score": {"type": "number", "minimum": 1.5, "maximum": 2},
+        "created": {"type": "string", "format": "date-time"},
+        "ip": {"type": "string", "format": "ipv4"},
+        "parent": {"type": ["object", "null"], "properties": {"id": {"type": "integer"}}}
+    },
+    "definitions": {
+        "user": {
+            "type": "object",
+            "properties": {
+                "first_name": {"type": "string"},
+                "age": {"type": "integer", "minimum": 18, "maximum": 99},
+                "active": {"type": "boolean"}
+            }
+        }
+    }
+}`
+
+func TestGenerateFromSchema(t *testing.T) {
+	collection := initTestCollection(t)
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuidRegexp := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, hash := range []string{"1", "2", "3", "4", "5"} {
+		out, err := GenerateFromSchema(schema, hash, collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out, `{"id":`) {
+			t.Errorf("properties are out of order: %s", out)
+		}
+		var doc struct {
+			Id   string
+			User struct {
+				FirstName string `json:"first_name"`
+				Age       *int
+				Active    *bool
+			}
+			Tags    []string
+			Role    string
+			Score   float64
+			Created string
+			Ip      string
+		}
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !uuidRegexp.MatchString(doc.Id) {
+			t.Errorf("id: uuid expected; actual %q", doc.Id)
+		}
+		if doc.User.FirstName == "" || doc.User.Active == nil {
+			t.Errorf("user: not generated from $ref: %s", out)
+		}
+		if doc.User.Age == nil || *doc.User.Age < 18 || *doc.User.Age > 99 {
+			t.Errorf("user.age: out of range: %s", out)
+		}
+		if len(doc.Tags) < 2 || len(doc.Tags) > 3 {
+			t.Errorf("tags: 2..3 items expected; actual %d", len(doc.Tags))
+		}
+		for _, tag := range doc.Tags {
+			if len(tag) < 3 || len(tag) > 5 {
+				t.Errorf("tags: length 3..5 expected; actual %q", tag)
+			}
+		}
+		if doc.Role != "admin" && doc.Role != "user" {
+			t.Errorf("role: enum value expected; actual %q", doc.Role)
+		}
+		if doc.Score < 1.5 || doc.Score > 2 {
+			t.Errorf("score: out of range: %v", doc.Score)
+		}
+		if _, err := time.Parse(time.RFC3339, doc.Created); err != nil {
+			t.Errorf("created: %v", err)
+		}
+		if net.ParseIP(doc.Ip) == nil {
+			t.Errorf("ip: IPv4 expected; actual %q", doc.Ip)
+		}
+
+		again, _ := GenerateFromSchema(schema, hash, collection)
+		if again != out {
+			t.Errorf("documents of hash %s differ:\n%s\n%s", hash, out, again)
+		}
+	}
+}
+
+func TestParseSchemaError(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "object", "properties": {"user": {"$ref": "#/definitions/missing"}}}`,
+		`{"type": "strings"}`,
+		`{"type": "integer", "minimum": 10, "maximum": 1}`,
+		`{"type": "array", "minItems": 3, "maxItems": 1}`,
+		`{"type": "array", "minItems": -1}`,
+		`{"type": "array", "maxItems": -1}`,
+		`{"type": "string", "minLength": -2}`,
+		`{"type": "integer", "minimum": -9223372036854775808, "maximum": 9223372036854775807}`,
+		`[]`,
+	} {
+		if _, err := ParseSchema([]byte(schema)); err == nil {
+			t.Errorf("%s: error expected", schema)
+		}
+	}
+
+	// the first error in order of properties
+	schema := `{"type": "object", "properties": {"b": {"type": "b"}, "a": {"type": "a"}, "c": {"type": "c"}}}`
+	for i := 0; i < 10; i++ {
+		if _, err := ParseSchema([]byte(schema)); err == nil || !strings.Contains(err.Error(), "properties/a") {
+			t.Fatalf("the error of property a expected; actual %v", err)
+		}
+	}
+}
+
+func TestGenerateFromRecursiveSchema(t *testing.T) {
+	collection := initTestCollection(t)
+	schema, err := ParseSchema([]byte(`{
+        "$defs": {"node": {"type": "object", "required": ["name"], "properties": {
+            "name": {"type": "string"},
+            "children": {"type": "array", "items": {"$ref": "#/$defs/node"}}
+        }}},
+        "$ref": "#/$defs/node"
+    }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := GenerateFromSchema(schema, "1", collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		t.Errorf("%v: %s", err, out)
+	}
+}
@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/flosch/pongo2.v3"
+)
+
+// validateHash is the hash of trial renders.
+const validateHash = "00000000-0000-0000-0000-000000000000"
+
+// TemplateError is a problem of a template found by Validate.
+// Line and Column are 1-based, zero if unknown.
+type TemplateError struct {
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Function string `json:"function,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// AsTemplateError returns the error of a render or a parse as a TemplateError,
+// with the position of the problem if it's known.
+func AsTemplateError(err error) *TemplateError {
+	if terr, ok := err.(*TemplateError); ok {
+		return terr
+	}
+	return newTemplateError(err)
+}
+
+func newTemplateError(err error) *TemplateError {
+	perr, ok := err.(*pongo2.Error)
+	if !ok {
+		return &TemplateError{Message: err.Error()}
+	}
+	e := &TemplateError{Line: perr.Line, Column: perr.Column, Message: perr.ErrorMsg}
+	if perr.Token != nil {
+		e.Token = perr.Token.Val
+	}
+	return e
+}
+
+var (
+	// tagRegexp matches {{ variable }} and {% tag %} blocks
+	tagRegexp    = regexp.MustCompile(`(?s){{.*?}}|{%.*?%}`)
+	stringRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	callRegexp   = regexp.MustCompile(`([A-Za-z_][\w.]*)\s*\(`)
+	macroRegexp  = regexp.MustCompile(`{%-?\s*macro\s+(\w+)`)
+)
+
+// templateKeywords may precede a parenthesis without being a function call.
+var templateKeywords = map[string]bool{
+	"in": true, "and": true, "or": true, "not": true, "is": true,
+	"if": true, "elif": true, "else": true, "for": true, "with": true,
+	"as": true, "only": true, "macro": true, "import": true, "from": true, "export": true,
+}
+
+func blank(s string) string {
+	return strings.Repeat(" ", len(s))
+}
+
+// unknownFunctions finds calls of functions missing in ctx, pongo2 renders them as empty strings.
+func unknownFunctions(template string, ctx pongo2.Context) []*TemplateError {
+	macros := make(map[string]bool)
+	for _, m := range macroRegexp.FindAllStringSubmatch(template, -1) {
+		macros[m[1]] = true
+	}
+
+	var errs []*TemplateError
+	for _, tag := range tagRegexp.FindAllStringIndex(template, -1) {
+		// blank string literals out keeping offsets
+		code := stringRegexp.ReplaceAllStringFunc(template[tag[0]:tag[1]], blank)
+		for _, call := range callRegexp.FindAllStringSubmatchIndex(code, -1) {
+			name := code[call[2]:call[3]]
+			if strings.Contains(name, ".") {
+				// a method, e.g. request.header("X-Name")
+				continue
+			}
+			if _, ok := ctx[name]; ok || macros[name] || templateKeywords[name] {
+				continue
+			}
+			line, column := position(template, tag[0]+call[2])
+			errs = append(errs, &TemplateError{
+				Line:     line,
+				Column:   column,
+				Token:    name,
+				Function: name,
+				Message:  fmt.Sprintf("unknown function %s", name),
+			})
+		}
+	}
+	return errs
+}
+
+// position returns the 1-based line and column of offset.
+func position(s string, offset int) (line, column int) {
+	before := s[:offset]
+	lineStart := strings.LastIndex(before, "\n") + 1
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// Validate compiles the template, looks for calls of unknown functions and renders
+// it once with extra variables. It returns nil for a valid template.
+func Validate(template string, collection *RandomDataCollection, extra map[string]interface{}) []*TemplateError {
+	tpl, err := pongo2.FromString(template)
+	if err != nil {
+		return []*TemplateError{newTemplateError(err)}
+	}
+
+	ctx := pongo2.Context{}
+	for k, v := range extra {
+		ctx[k] = v
+	}
+	ctx.Update(newContext(NewRandomData(validateHash, collection)))
+	if errs := unknownFunctions(template, ctx); len(errs) > 0 {
+		return errs
+	}
+
+	if _, err := execute(tpl, ctx); err != nil {
+		return []*TemplateError{newTemplateError(err)}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	collection := initTestCollection(t)
+	valid := []string{
+		testTemplateJson,
+		`{{ "Foo(" }} {% if a and (b or c) %}{% endif %}`,
+		`{% macro greet(name) %}Hi {{ name }}{% endmacro %}{{ greet(FirstName()) }}`,
+		`{{ request.header("X-Name") }}`,
+	}
+	for _, tpl := range valid {
+		if errs := Validate(tpl, collection, nil); errs != nil {
+			t.Errorf("%q expected to be valid; actual %v", tpl, errs)
+		}
+	}
+
+	cases := []struct {
+		template string
+		expected TemplateError
+	}{
+		{"{\n  \"a\": {{ FirstName( }}\n}", TemplateError{Line: 2, Column: 22, Token: "}}"}},
+		{"{\n  \"a\": \"{{ FristName() }}\"\n}", TemplateError{Line: 2, Column: 12, Token: "FristName", Function: "FristName"}},
+		{"{% for x in %}{% endfor %}", TemplateError{Line: 1, Column: 10, Token: "in"}},
+		{"{{ Number(0) }}", TemplateError{}},
+	}
+	for _, c := range cases {
+		errs := Validate(c.template, collection, nil)
+		if len(errs) != 1 {
+			t.Errorf("%q: expected 1 error; actual %v", c.template, errs)
+			continue
+		}
+		e := errs[0]
+		if e.Line != c.expected.Line || e.Column != c.expected.Column || e.Token != c.expected.Token || e.Function != c.expected.Function {
+			t.Errorf("%q: error expected %+v; actual %+v", c.template, c.expected, e)
+		}
+		if e.Message == "" {
+			t.Errorf("%q: error message expected", c.template)
+		}
+	}
+}